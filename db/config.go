@@ -6,6 +6,11 @@ import (
 	"time"
 )
 
+const (
+	DefaultConnectMaxRetries           = 10
+	DefaultConnectRetryIntervalSeconds = 3
+)
+
 type Config struct {
 	Type                   string `json:"type" validate:"nonzero"`
 	User                   string `json:"user" validate:"nonzero"`
@@ -17,6 +22,61 @@ type Config struct {
 	RequireSSL             bool   `json:"require_ssl" validate:""`
 	CACert                 string `json:"ca_cert" validate:""`
 	SkipHostnameValidation bool   `json:"skip_hostname_validation" validate:""`
+
+	MaxOpenConnections            int `json:"max_open_connections" validate:"min=0"`
+	MaxIdleConnections            int `json:"max_idle_connections" validate:"min=0"`
+	ConnectionsMaxLifetimeSeconds int `json:"connections_max_lifetime_seconds" validate:"min=0"`
+	ConnectionsMaxIdleTimeSeconds int `json:"connections_max_idle_time_seconds" validate:"min=0"`
+	ConnectRetryIntervalSeconds   int `json:"connect_retry_interval_seconds" validate:"min=0"`
+	StatementCacheSize            int `json:"statement_cache_size" validate:"min=0"`
+	// ConnectMaxRetries is a pointer so that 0, i.e. a single attempt, can be
+	// told apart from unset.
+	ConnectMaxRetries *int `json:"connect_max_retries,omitempty" validate:""`
+}
+
+// WithDefaults returns a copy of the config with the connect retry policy
+// filled in where it was left unset. Zero pool settings keep the database/sql
+// defaults.
+func (c Config) WithDefaults() Config {
+	if c.ConnectMaxRetries == nil {
+		maxRetries := DefaultConnectMaxRetries
+		c.ConnectMaxRetries = &maxRetries
+	}
+	if c.ConnectRetryIntervalSeconds == 0 {
+		c.ConnectRetryIntervalSeconds = DefaultConnectRetryIntervalSeconds
+	}
+	return c
+}
+
+func (c Config) Validate() error {
+	if c.Timeout < 1 {
+		return fmt.Errorf("timeout must be at least 1 second: %d", c.Timeout)
+	}
+	if c.MaxOpenConnections < 0 {
+		return fmt.Errorf("max_open_connections must not be negative: %d", c.MaxOpenConnections)
+	}
+	if c.MaxIdleConnections < 0 {
+		return fmt.Errorf("max_idle_connections must not be negative: %d", c.MaxIdleConnections)
+	}
+	if c.MaxOpenConnections > 0 && c.MaxIdleConnections > c.MaxOpenConnections {
+		return fmt.Errorf("max_idle_connections (%d) must not exceed max_open_connections (%d)", c.MaxIdleConnections, c.MaxOpenConnections)
+	}
+	if c.ConnectionsMaxLifetimeSeconds < 0 {
+		return fmt.Errorf("connections_max_lifetime_seconds must not be negative: %d", c.ConnectionsMaxLifetimeSeconds)
+	}
+	if c.ConnectionsMaxIdleTimeSeconds < 0 {
+		return fmt.Errorf("connections_max_idle_time_seconds must not be negative: %d", c.ConnectionsMaxIdleTimeSeconds)
+	}
+	if c.ConnectMaxRetries != nil && *c.ConnectMaxRetries < 0 {
+		return fmt.Errorf("connect_max_retries must not be negative: %d", *c.ConnectMaxRetries)
+	}
+	if c.ConnectRetryIntervalSeconds < 0 {
+		return fmt.Errorf("connect_retry_interval_seconds must not be negative: %d", c.ConnectRetryIntervalSeconds)
+	}
+	if c.StatementCacheSize < 0 {
+		return fmt.Errorf("statement_cache_size must not be negative: %d", c.StatementCacheSize)
+	}
+	return nil
 }
 
 func (c Config) ConnectionString() (string, error) {
@@ -1,6 +1,7 @@
 package db_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 
 	"code.cloudfoundry.org/cf-networking-helpers/db"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
 	. "github.com/onsi/gomega"
 )
 
@@ -220,4 +222,82 @@ var _ = Describe("Config", func() {
 			})
 		})
 	})
+
+	Describe("WithDefaults", func() {
+		It("fills in the connect retry policy", func() {
+			config = config.WithDefaults()
+			Expect(*config.ConnectMaxRetries).To(Equal(db.DefaultConnectMaxRetries))
+			Expect(config.ConnectRetryIntervalSeconds).To(Equal(db.DefaultConnectRetryIntervalSeconds))
+		})
+
+		It("keeps values that are already set", func() {
+			maxRetries := 2
+			config.ConnectMaxRetries = &maxRetries
+			config.ConnectRetryIntervalSeconds = 7
+			config.MaxOpenConnections = 20
+
+			config = config.WithDefaults()
+			Expect(*config.ConnectMaxRetries).To(Equal(2))
+			Expect(config.ConnectRetryIntervalSeconds).To(Equal(7))
+			Expect(config.MaxOpenConnections).To(Equal(20))
+		})
+
+		It("keeps connect retries that are set to 0", func() {
+			Expect(json.Unmarshal([]byte(`{"connect_max_retries": 0}`), &config)).To(Succeed())
+
+			config = config.WithDefaults()
+			Expect(*config.ConnectMaxRetries).To(Equal(0))
+			Expect(config.Validate()).To(Succeed())
+		})
+
+		It("leaves the pool settings unset", func() {
+			config = config.WithDefaults()
+			Expect(config.MaxOpenConnections).To(BeZero())
+			Expect(config.MaxIdleConnections).To(BeZero())
+			Expect(config.ConnectionsMaxLifetimeSeconds).To(BeZero())
+			Expect(config.ConnectionsMaxIdleTimeSeconds).To(BeZero())
+		})
+	})
+
+	Describe("Validate", func() {
+		BeforeEach(func() {
+			config.MaxOpenConnections = 10
+			config.MaxIdleConnections = 5
+			config.ConnectionsMaxLifetimeSeconds = 3600
+			config.ConnectionsMaxIdleTimeSeconds = 60
+		})
+
+		It("accepts a valid config", func() {
+			Expect(config.Validate()).To(Succeed())
+		})
+
+		It("accepts idle connections when max open connections is unlimited", func() {
+			config.MaxOpenConnections = 0
+			Expect(config.Validate()).To(Succeed())
+		})
+
+		It("rejects a timeout less than 1", func() {
+			config.Timeout = 0
+			Expect(config.Validate()).To(MatchError("timeout must be at least 1 second: 0"))
+		})
+
+		It("rejects more idle connections than open connections", func() {
+			config.MaxIdleConnections = 11
+			Expect(config.Validate()).To(MatchError("max_idle_connections (11) must not exceed max_open_connections (10)"))
+		})
+
+		DescribeTable("rejects negative values",
+			func(mutate func(*db.Config), expectedError string) {
+				mutate(&config)
+				Expect(config.Validate()).To(MatchError(expectedError))
+			},
+			Entry("max open connections", func(c *db.Config) { c.MaxOpenConnections = -1 }, "max_open_connections must not be negative: -1"),
+			Entry("max idle connections", func(c *db.Config) { c.MaxIdleConnections = -1 }, "max_idle_connections must not be negative: -1"),
+			Entry("max lifetime", func(c *db.Config) { c.ConnectionsMaxLifetimeSeconds = -1 }, "connections_max_lifetime_seconds must not be negative: -1"),
+			Entry("max idle time", func(c *db.Config) { c.ConnectionsMaxIdleTimeSeconds = -1 }, "connections_max_idle_time_seconds must not be negative: -1"),
+			Entry("connect retries", func(c *db.Config) { maxRetries := -1; c.ConnectMaxRetries = &maxRetries }, "connect_max_retries must not be negative: -1"),
+			Entry("connect retry interval", func(c *db.Config) { c.ConnectRetryIntervalSeconds = -1 }, "connect_retry_interval_seconds must not be negative: -1"),
+			Entry("statement cache size", func(c *db.Config) { c.StatementCacheSize = -1 }, "statement_cache_size must not be negative: -1"),
+		)
+	})
 })
@@ -1,47 +1,124 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 
 	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
 	"github.com/jmoiron/sqlx"
 )
 
 type ConnWrapper struct {
 	*sqlx.DB
 	Monitor monitor.Monitor
+	// Spans, when set, records a span for each query and transaction. They
+	// are children of the span in the context passed to QueryContext,
+	// QueryRowContext or BeginTxx, e.g. that of the HTTP request, if any.
+	// Statements run in a transaction are children of its span.
+	Spans tracing.SpanRecorder
+
+	statementCache *StatementCache
+}
+
+// EnableStatementCache makes Query, QueryRow and transactions started with
+// Beginx reuse up to capacity prepared statements. It must be called before
+// the connection is shared between goroutines.
+func (c *ConnWrapper) EnableStatementCache(capacity int) {
+	c.statementCache = NewStatementCache(c.DB, capacity)
+}
+
+// StatementCache returns nil unless EnableStatementCache has been called.
+func (c *ConnWrapper) StatementCache() *StatementCache {
+	return c.statementCache
 }
 
 func (c *ConnWrapper) Beginx() (Transaction, error) {
+	return c.BeginTxx(context.Background(), nil)
+}
+
+func (c *ConnWrapper) BeginTxx(ctx context.Context, opts *sql.TxOptions) (Transaction, error) {
 	var innerTx *sqlx.Tx
 	err := c.Monitor.Monitor(func() error {
 		var err error
-		innerTx, err = c.DB.Beginx()
+		innerTx, err = c.DB.BeginTxx(ctx, opts)
 		return err
 	})
 
 	tx := &monitoredTx{
-		tx:      innerTx,
-		monitor: c.Monitor,
+		tx:             innerTx,
+		monitor:        c.Monitor,
+		statementCache: c.statementCache,
+		spans:          c.Spans,
+	}
+	if c.Spans != nil && err == nil {
+		span := tracing.StartSpan("db.transaction", tracing.SpanKindClient, parentSpan(ctx))
+		tx.span = &span
 	}
 
 	return tx, err
 }
 
 func (c *ConnWrapper) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+func (c *ConnWrapper) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
 	var result *sql.Rows
-	err := c.Monitor.Monitor(func() error {
+	err := traced(c.Spans, parentSpan(ctx), "db.query", query, func() error {
+		return c.Monitor.Monitor(func() error {
+			var err error
+			result, err = c.query(ctx, query, args...)
+			return err
+		})
+	})
+	return result, err
+}
+
+func (c *ConnWrapper) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if c.statementCache == nil {
+		return c.DB.QueryContext(ctx, query, args...)
+	}
+
+	var result *sql.Rows
+	err := c.statementCache.withStatement(query, true, func(stmt *sqlx.Stmt) error {
+		var err error
+		result, err = stmt.QueryContext(ctx, args...)
+		return err
+	}, func() error {
 		var err error
-		result, err = c.DB.Query(query, args...)
+		result, err = c.DB.QueryContext(ctx, query, args...)
 		return err
 	})
 	return result, err
 }
 
 func (c *ConnWrapper) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+func (c *ConnWrapper) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
 	var result *sql.Row
-	c.Monitor.Monitor(func() error {
-		result = c.DB.QueryRow(query, args...)
+	traced(c.Spans, parentSpan(ctx), "db.query", query, func() error {
+		return c.Monitor.Monitor(func() error {
+			result = c.queryRow(ctx, query, args...)
+			return nil
+		})
+	})
+	return result
+}
+
+func (c *ConnWrapper) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if c.statementCache == nil {
+		return c.DB.QueryRowContext(ctx, query, args...)
+	}
+
+	var result *sql.Row
+	c.statementCache.withStatement(query, true, func(stmt *sqlx.Stmt) error {
+		result = stmt.Stmt.QueryRowContext(ctx, args...)
+		return nil
+	}, func() error {
+		result = c.DB.QueryRowContext(ctx, query, args...)
 		return nil
 	})
 	return result
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 )
 
@@ -12,18 +13,19 @@ func NewConnectionPool(conf Config,
 	maxOpenConnections int, maxIdleConnections int, connMaxLifetime time.Duration,
 	logPrefix string, jobPrefix string, logger lager.Logger,
 ) (*ConnWrapper, error) {
+	return NewConnectionPoolContext(context.Background(), conf,
+		maxOpenConnections, maxIdleConnections, connMaxLifetime,
+		logPrefix, jobPrefix, logger)
+}
 
-	retriableConnector := RetriableConnector{
-		Logger:        logger,
-		Connector:     GetConnectionPool,
-		Sleeper:       SleeperFunc(time.Sleep),
-		RetryInterval: time.Duration(3) * time.Second,
-		MaxRetries:    10,
-	}
-
-	logger.Info("getting db connection", lager.Data{})
-	timeoutCtx, _ := context.WithTimeout(context.Background(), time.Duration(conf.Timeout)*time.Second)
-	connectionPool, err := retriableConnector.GetConnectionPool(conf, timeoutCtx)
+// NewConnectionPoolContext gives each connection attempt conf.Timeout seconds
+// and stops retrying once ctx is done, so a job can abandon startup on
+// SIGTERM while the database is unreachable.
+func NewConnectionPoolContext(ctx context.Context, conf Config,
+	maxOpenConnections int, maxIdleConnections int, connMaxLifetime time.Duration,
+	logPrefix string, jobPrefix string, logger lager.Logger,
+) (*ConnWrapper, error) {
+	connectionPool, err := connectWithRetries(ctx, conf, logger)
 	if err != nil {
 		return nil, fmt.Errorf("%s.%s: db connect: %s", logPrefix, jobPrefix, err)
 	}
@@ -31,7 +33,60 @@ func NewConnectionPool(conf Config,
 	connectionPool.SetMaxOpenConns(maxOpenConnections)
 	connectionPool.SetMaxIdleConns(maxIdleConnections)
 	connectionPool.SetConnMaxLifetime(connMaxLifetime)
+	connectionPool.SetConnMaxIdleTime(time.Duration(conf.ConnectionsMaxIdleTimeSeconds) * time.Second)
+	logger.Info("db connection retrieved", lager.Data{})
+
+	return connectionPool, nil
+}
+
+func NewConnectionPoolFromConfig(conf Config, logger lager.Logger) (*ConnWrapper, error) {
+	return NewConnectionPoolFromConfigContext(context.Background(), conf, logger)
+}
+
+func NewConnectionPoolFromConfigContext(ctx context.Context, conf Config, logger lager.Logger) (*ConnWrapper, error) {
+	conf = conf.WithDefaults()
+	if err := conf.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid db config: %s", err)
+	}
+
+	connectionPool, err := connectWithRetries(ctx, conf, logger)
+	if err != nil {
+		return nil, fmt.Errorf("db connect: %s", err)
+	}
+
+	// Settings left at zero keep the database/sql defaults.
+	if conf.MaxOpenConnections > 0 {
+		connectionPool.SetMaxOpenConns(conf.MaxOpenConnections)
+	}
+	if conf.MaxIdleConnections > 0 {
+		connectionPool.SetMaxIdleConns(conf.MaxIdleConnections)
+	}
+	if conf.ConnectionsMaxLifetimeSeconds > 0 {
+		connectionPool.SetConnMaxLifetime(time.Duration(conf.ConnectionsMaxLifetimeSeconds) * time.Second)
+	}
+	if conf.ConnectionsMaxIdleTimeSeconds > 0 {
+		connectionPool.SetConnMaxIdleTime(time.Duration(conf.ConnectionsMaxIdleTimeSeconds) * time.Second)
+	}
+	if conf.StatementCacheSize > 0 {
+		connectionPool.EnableStatementCache(conf.StatementCacheSize)
+	}
 	logger.Info("db connection retrieved", lager.Data{})
 
 	return connectionPool, nil
 }
+
+func connectWithRetries(ctx context.Context, conf Config, logger lager.Logger) (*ConnWrapper, error) {
+	conf = conf.WithDefaults()
+
+	retriableConnector := RetriableConnector{
+		Logger:         logger,
+		Connector:      GetConnectionPool,
+		Clock:          clock.NewClock(),
+		RetryInterval:  time.Duration(conf.ConnectRetryIntervalSeconds) * time.Second,
+		MaxRetries:     *conf.ConnectMaxRetries,
+		ConnectTimeout: time.Duration(conf.Timeout) * time.Second,
+	}
+
+	logger.Info("getting db connection", lager.Data{})
+	return retriableConnector.GetConnectionPool(conf, ctx)
+}
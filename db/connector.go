@@ -34,7 +34,7 @@ func GetConnectionPool(dbConfig Config, ctx context.Context) (*ConnWrapper, erro
 
 	dbConn := sqlx.NewDb(nativeDBConn, dbConfig.Type)
 
-	if err = dbConn.PingContext(ctx); err != nil {
+	if err = ping(ctx, dbConn); err != nil {
 		dbConn.Close()
 		if netErr, ok := err.(*net.OpError); ok {
 			return nil, RetriableError{
@@ -50,3 +50,23 @@ func GetConnectionPool(dbConfig Config, ctx context.Context) (*ConnWrapper, erro
 		Monitor: monitor.New(),
 	}, nil
 }
+
+// ping gives up as soon as ctx is done. lib/pq does not watch ctx while it
+// connects, so without this a connect attempt could outlast its deadline.
+// When it gives up it closes the pool, so that the connection the abandoned
+// ping is still opening is closed as soon as the driver returns it, at the
+// latest when the driver's own connect timeout is up.
+func ping(ctx context.Context, dbConn *sqlx.DB) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- dbConn.PingContext(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		dbConn.Close()
+		return ctx.Err()
+	}
+}
@@ -2,8 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"time"
 
 	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -23,13 +25,38 @@ type RowScanner interface {
 }
 
 type monitoredTx struct {
-	tx      *sqlx.Tx
-	monitor monitor.Monitor
+	tx             *sqlx.Tx
+	monitor        monitor.Monitor
+	statementCache *StatementCache
+	spans          tracing.SpanRecorder
+	span           *tracing.Span
 }
 
 func (tx *monitoredTx) Exec(query string, args ...interface{}) (sql.Result, error) {
 	var result sql.Result
-	err := tx.monitor.Monitor(func() error {
+	err := traced(tx.spans, tx.span, "db.exec", query, func() error {
+		return tx.monitor.Monitor(func() error {
+			var err error
+			result, err = tx.exec(query, args...)
+			return err
+		})
+	})
+	return result, err
+}
+
+func (tx *monitoredTx) exec(query string, args ...interface{}) (sql.Result, error) {
+	if tx.statementCache == nil {
+		return tx.tx.Exec(query, args...)
+	}
+
+	var result sql.Result
+	err := tx.statementCache.withStatement(query, false, func(stmt *sqlx.Stmt) error {
+		txStmt := tx.tx.Stmtx(stmt)
+		defer txStmt.Close()
+		var err error
+		result, err = txStmt.Exec(args...)
+		return err
+	}, func() error {
 		var err error
 		result, err = tx.tx.Exec(query, args...)
 		return err
@@ -38,12 +65,55 @@ func (tx *monitoredTx) Exec(query string, args ...interface{}) (sql.Result, erro
 }
 
 func (tx *monitoredTx) QueryRow(query string, args ...interface{}) RowScanner {
-	return NewRowScanner(tx.monitor, tx.tx.QueryRow(query, args...))
+	var result *sql.Row
+	traced(tx.spans, tx.span, "db.query", query, func() error {
+		result = tx.queryRow(query, args...)
+		return nil
+	})
+	return NewRowScanner(tx.monitor, result)
+}
+
+// Statements prepared for the transaction by queryRow and queryx are closed
+// when it commits or rolls back.
+func (tx *monitoredTx) queryRow(query string, args ...interface{}) *sql.Row {
+	if tx.statementCache == nil {
+		return tx.tx.QueryRow(query, args...)
+	}
+
+	var result *sql.Row
+	tx.statementCache.withStatement(query, false, func(stmt *sqlx.Stmt) error {
+		result = tx.tx.Stmtx(stmt).Stmt.QueryRow(args...)
+		return nil
+	}, func() error {
+		result = tx.tx.QueryRow(query, args...)
+		return nil
+	})
+	return result
 }
 
 func (tx *monitoredTx) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
 	var result *sqlx.Rows
-	err := tx.monitor.Monitor(func() error {
+	err := traced(tx.spans, tx.span, "db.query", query, func() error {
+		return tx.monitor.Monitor(func() error {
+			var err error
+			result, err = tx.queryx(query, args...)
+			return err
+		})
+	})
+	return result, err
+}
+
+func (tx *monitoredTx) queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	if tx.statementCache == nil {
+		return tx.tx.Queryx(query, args...)
+	}
+
+	var result *sqlx.Rows
+	err := tx.statementCache.withStatement(query, false, func(stmt *sqlx.Stmt) error {
+		var err error
+		result, err = tx.tx.Stmtx(stmt).Queryx(args...)
+		return err
+	}, func() error {
 		var err error
 		result, err = tx.tx.Queryx(query, args...)
 		return err
@@ -52,11 +122,27 @@ func (tx *monitoredTx) Queryx(query string, args ...interface{}) (*sqlx.Rows, er
 }
 
 func (tx *monitoredTx) Commit() error {
-	return tx.monitor.Monitor(tx.tx.Commit)
+	err := tx.monitor.Monitor(tx.tx.Commit)
+	tx.endSpan(err)
+	return err
 }
 
 func (tx *monitoredTx) Rollback() error {
-	return tx.monitor.Monitor(tx.tx.Rollback)
+	err := tx.monitor.Monitor(tx.tx.Rollback)
+	tx.endSpan(err)
+	return err
+}
+
+// endSpan records the transaction span the first time the transaction
+// commits or rolls back.
+func (tx *monitoredTx) endSpan(err error) {
+	if tx.span == nil {
+		return
+	}
+	tx.span.End = time.Now()
+	tx.span.Err = err
+	tx.spans.RecordSpan(*tx.span)
+	tx.span = nil
 }
 
 func (tx *monitoredTx) Rebind(query string) string {
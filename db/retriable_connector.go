@@ -2,8 +2,10 @@ package db
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
 )
 
@@ -12,6 +14,10 @@ type sleeper interface {
 	Sleep(time.Duration)
 }
 
+// SleeperFunc adapts time.Sleep or a similar function to
+// RetriableConnector.Sleeper.
+//
+// Deprecated: set RetriableConnector.Clock instead.
 type SleeperFunc func(time.Duration)
 
 func (sf SleeperFunc) Sleep(duration time.Duration) {
@@ -19,31 +25,90 @@ func (sf SleeperFunc) Sleep(duration time.Duration) {
 }
 
 type RetriableConnector struct {
-	Logger        lager.Logger
-	Connector     func(Config, context.Context) (*ConnWrapper, error)
+	Logger    lager.Logger
+	Connector func(Config, context.Context) (*ConnWrapper, error)
+	// Deprecated: set Clock instead. Sleeper is only used when Clock is nil,
+	// and a Sleep that is cut short by ctx keeps running in the background.
 	Sleeper       sleeper
 	RetryInterval time.Duration
 	MaxRetries    int
+	// ConnectTimeout bounds each attempt. When zero, every attempt gets the
+	// caller's context as is.
+	ConnectTimeout time.Duration
+	// Clock is used to wait between attempts. When neither Clock nor Sleeper
+	// is set, it defaults to the real clock.
+	Clock clock.Clock
 }
 
+// GetConnectionPool stops retrying as soon as ctx is done, including while
+// waiting between attempts. An attempt cut off by ConnectTimeout is retried.
 func (r *RetriableConnector) GetConnectionPool(dbConfig Config, ctx context.Context) (*ConnWrapper, error) {
 	var attempts int
 	for {
 		attempts++
 
-		db, err := r.Connector(dbConfig, ctx)
+		db, err := r.connect(dbConfig, ctx)
 		if err == nil {
 			return db, nil
 		}
 
-		if _, ok := err.(RetriableError); ok && attempts < r.MaxRetries {
+		if _, ok := err.(RetriableError); ok && attempts < r.MaxRetries && ctx.Err() == nil {
 			r.Logger.Info("retrying due to getting an error", lager.Data{
 				"error": err,
 			})
-			r.Sleeper.Sleep(r.RetryInterval)
+			if sleepErr := r.sleep(ctx); sleepErr != nil {
+				return nil, fmt.Errorf("%s: %s", sleepErr, err)
+			}
 			continue
 		}
 
 		return nil, err
 	}
 }
+
+func (r *RetriableConnector) connect(dbConfig Config, ctx context.Context) (*ConnWrapper, error) {
+	if r.ConnectTimeout <= 0 {
+		return r.Connector(dbConfig, ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, r.ConnectTimeout)
+	defer cancel()
+	db, err := r.Connector(dbConfig, attemptCtx)
+	if err != nil && attemptCtx.Err() != nil && ctx.Err() == nil {
+		if _, ok := err.(RetriableError); !ok {
+			err = RetriableError{Inner: err, Msg: "connect attempt timed out"}
+		}
+	}
+	return db, err
+}
+
+func (r *RetriableConnector) sleep(ctx context.Context) error {
+	if r.Clock == nil && r.Sleeper != nil {
+		slept := make(chan struct{})
+		go func() {
+			r.Sleeper.Sleep(r.RetryInterval)
+			close(slept)
+		}()
+
+		select {
+		case <-slept:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	c := r.Clock
+	if c == nil {
+		c = clock.NewClock()
+	}
+	timer := c.NewTimer(r.RetryInterval)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C():
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -3,10 +3,15 @@ package db_test
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"code.cloudfoundry.org/cf-networking-helpers/db"
 	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/lagertest"
 
 	. "github.com/onsi/ginkgo"
@@ -17,25 +22,40 @@ import (
 var _ = Describe("RetriableConnector", func() {
 	var (
 		logger             *lagertest.TestLogger
-		sleeper            *fakes.Sleeper
+		clock              *fakeclock.FakeClock
 		retriableConnector *db.RetriableConnector
-		numTries           int
+		numTries           int32
+		lock               sync.Mutex
 		passedContext      context.Context
 	)
 
+	tries := func() int32 {
+		return atomic.LoadInt32(&numTries)
+	}
+
+	connect := func(ctx context.Context) <-chan error {
+		result := make(chan error, 1)
+		go func() {
+			_, err := retriableConnector.GetConnectionPool(db.Config{}, ctx)
+			result <- err
+		}()
+		return result
+	}
+
 	BeforeEach(func() {
-		sleeper = &fakes.Sleeper{}
 		logger = lagertest.NewTestLogger("test")
-		numTries = 0
+		clock = fakeclock.NewFakeClock(time.Now())
+		atomic.StoreInt32(&numTries, 0)
 
 		retriableConnector = &db.RetriableConnector{
 			Logger:        logger,
-			Sleeper:       sleeper,
+			Clock:         clock,
 			RetryInterval: time.Minute,
-			Connector: func(config db.Config, context context.Context) (*db.ConnWrapper, error) {
-				passedContext = context
-				numTries++
-				if numTries > 3 {
+			Connector: func(config db.Config, ctx context.Context) (*db.ConnWrapper, error) {
+				lock.Lock()
+				passedContext = ctx
+				lock.Unlock()
+				if atomic.AddInt32(&numTries, 1) > 3 {
 					return nil, nil
 				}
 				return nil, db.RetriableError{Inner: errors.New("welp")}
@@ -57,46 +77,143 @@ var _ = Describe("RetriableConnector", func() {
 	})
 
 	Context("when the inner Connector returns a retriable error", func() {
-		It("retries the connection", func() {
+		BeforeEach(func() {
 			retriableConnector.MaxRetries = 5
+		})
 
-			ctx, _ := context.WithTimeout(context.Background(), 1*time.Second)
-			_, err := retriableConnector.GetConnectionPool(db.Config{}, ctx)
+		It("retries the connection", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			result := connect(ctx)
 
-			Expect(numTries).To(Equal(4))
-			Expect(passedContext).To(Equal(ctx))
-			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 3; i++ {
+				clock.WaitForWatcherAndIncrement(time.Minute)
+			}
 
+			Eventually(result).Should(Receive(BeNil()))
+			Expect(tries()).To(Equal(int32(4)))
+			lock.Lock()
+			defer lock.Unlock()
+			Expect(passedContext).To(Equal(ctx))
 		})
 
-		It("waits between retries", func() {
-			retriableConnector.MaxRetries = 5
+		It("waits the retry interval between attempts", func() {
+			result := connect(context.Background())
 
-			_, err := retriableConnector.GetConnectionPool(db.Config{}, context.Background())
-			Expect(err).To(Succeed())
+			Eventually(clock.WatcherCount).Should(Equal(1))
+			clock.Increment(time.Minute - time.Second)
+			Consistently(tries).Should(Equal(int32(1)))
 
-			Expect(sleeper.SleepCallCount()).To(Equal(3))
-			Expect(sleeper.SleepArgsForCall(0)).To(Equal(time.Minute))
-			Expect(sleeper.SleepArgsForCall(1)).To(Equal(time.Minute))
-			Expect(sleeper.SleepArgsForCall(2)).To(Equal(time.Minute))
+			clock.Increment(time.Second)
+			Eventually(tries).Should(Equal(int32(2)))
 
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			clock.WaitForWatcherAndIncrement(time.Minute)
+			Eventually(result).Should(Receive(BeNil()))
 			Expect(logger).To(gbytes.Say("retrying due to getting an error"))
 		})
 
+		Context("when a deprecated Sleeper is set instead of a Clock", func() {
+			It("sleeps the retry interval between attempts with it", func() {
+				sleeper := &fakes.Sleeper{}
+				retriableConnector.Clock = nil
+				retriableConnector.Sleeper = sleeper
+
+				Eventually(connect(context.Background())).Should(Receive(BeNil()))
+				Expect(sleeper.SleepCallCount()).To(Equal(3))
+				Expect(sleeper.SleepArgsForCall(0)).To(Equal(time.Minute))
+			})
+		})
+
 		Context("when max retries have occurred", func() {
 			It("stops retrying and returns the last error", func() {
 				retriableConnector.MaxRetries = 10
 				retriableConnector.Connector = func(db.Config, context.Context) (*db.ConnWrapper, error) {
-					numTries++
+					atomic.AddInt32(&numTries, 1)
 					return nil, db.RetriableError{Inner: errors.New("welp")}
 				}
+				result := connect(context.Background())
 
-				_, err := retriableConnector.GetConnectionPool(db.Config{}, context.Background())
-				Expect(err).To(MatchError(db.RetriableError{Inner: errors.New("welp")}))
+				for i := 0; i < 9; i++ {
+					clock.WaitForWatcherAndIncrement(time.Minute)
+				}
 
-				Eventually(numTries).Should(Equal(10))
-				Expect(sleeper.SleepCallCount()).To(Equal(9))
+				Eventually(result).Should(Receive(MatchError(db.RetriableError{Inner: errors.New("welp")})))
+				Expect(tries()).To(Equal(int32(10)))
 			})
 		})
+
+		Context("when the context is cancelled while waiting to retry", func() {
+			It("stops waiting and returns the cancellation with the last error", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				result := connect(ctx)
+
+				Eventually(clock.WatcherCount).Should(Equal(1))
+				cancel()
+
+				Eventually(result).Should(Receive(MatchError("context canceled: : welp")))
+				Expect(tries()).To(Equal(int32(1)))
+				Expect(clock.WatcherCount()).To(Equal(0))
+			})
+		})
+
+		Context("when the context is already done", func() {
+			It("does not retry", func() {
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+
+				_, err := retriableConnector.GetConnectionPool(db.Config{}, ctx)
+				Expect(err).To(MatchError(db.RetriableError{Inner: errors.New("welp")}))
+				Expect(tries()).To(Equal(int32(1)))
+				Expect(clock.WatcherCount()).To(Equal(0))
+			})
+		})
+	})
+
+	Context("when a connect timeout is set", func() {
+		var proxy *testsupport.FaultProxy
+
+		BeforeEach(func() {
+			dbConf := testsupport.GetDBConfig()
+
+			var err error
+			proxy, err = testsupport.NewFaultProxy(fmt.Sprintf("%s:%d", dbConf.Host, dbConf.Port))
+			Expect(err).NotTo(HaveOccurred())
+			proxy.SetBlackHole(true)
+
+			retriableConnector.Clock = nil
+			retriableConnector.RetryInterval = 10 * time.Millisecond
+			retriableConnector.MaxRetries = 3
+			retriableConnector.ConnectTimeout = 200 * time.Millisecond
+			retriableConnector.Connector = func(config db.Config, ctx context.Context) (*db.ConnWrapper, error) {
+				atomic.AddInt32(&numTries, 1)
+				config.Host = proxy.Host()
+				config.Port = proxy.Port()
+				config.Timeout = 60
+				return db.GetConnectionPool(config, ctx)
+			}
+		})
+
+		AfterEach(func() {
+			proxy.Close()
+		})
+
+		It("retries attempts that run into it", func() {
+			start := time.Now()
+			_, err := retriableConnector.GetConnectionPool(testsupport.GetDBConfig(), context.Background())
+			Expect(err).To(BeAssignableToTypeOf(db.RetriableError{}))
+			Expect(tries()).To(Equal(int32(3)))
+			Expect(time.Since(start)).To(BeNumerically(">=", 600*time.Millisecond))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+
+		It("stops at the caller's deadline", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+			defer cancel()
+
+			_, err := retriableConnector.GetConnectionPool(testsupport.GetDBConfig(), ctx)
+			Expect(err).To(HaveOccurred())
+			Expect(tries()).To(Equal(int32(2)))
+		})
 	})
 })
@@ -0,0 +1,189 @@
+package db
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+// MySQL error ER_MAX_PREPARED_STMT_COUNT_REACHED
+const mysqlMaxPreparedStmtCountReached = 1461
+
+var errStatementNotCached = errors.New("statement not cached")
+
+// StatementCache keeps up to capacity prepared statements, evicting the least
+// recently used one when full. database/sql prepares each statement lazily on
+// every connection it runs on and re-prepares it when a connection is
+// replaced, so entries stay valid across reconnects.
+type StatementCache struct {
+	db       *sqlx.DB
+	capacity int
+
+	lock    sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type statementCacheEntry struct {
+	query   string
+	stmt    *sqlx.Stmt
+	refs    int
+	evicted bool
+}
+
+func NewStatementCache(db *sqlx.DB, capacity int) *StatementCache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &StatementCache{
+		db:       db,
+		capacity: capacity,
+		entries:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+func (c *StatementCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.lru.Len()
+}
+
+// Purge closes and forgets every cached statement. Statements in use are
+// closed once released.
+func (c *StatementCache) Purge() {
+	c.lock.Lock()
+	var toClose []*sqlx.Stmt
+	for e := c.lru.Front(); e != nil; {
+		next := e.Next()
+		if stmt := c.evictLocked(e); stmt != nil {
+			toClose = append(toClose, stmt)
+		}
+		e = next
+	}
+	c.lock.Unlock()
+
+	for _, stmt := range toClose {
+		stmt.Close()
+	}
+}
+
+// Prepare warms the cache with queries, such as the hot statements that a
+// job only runs inside transactions.
+func (c *StatementCache) Prepare(queries ...string) error {
+	for _, query := range queries {
+		entry, err := c.acquire(query, true)
+		if err != nil {
+			return fmt.Errorf("prepare statement: %s", err)
+		}
+		c.release(entry)
+	}
+	return nil
+}
+
+// acquire returns the cached statement for query, preparing it if it is
+// missing and prepare is set. Every successful acquire must be paired with a
+// release.
+func (c *StatementCache) acquire(query string, prepare bool) (*statementCacheEntry, error) {
+	c.lock.Lock()
+	if e, ok := c.entries[query]; ok {
+		c.lru.MoveToFront(e)
+		entry := e.Value.(*statementCacheEntry)
+		entry.refs++
+		c.lock.Unlock()
+		return entry, nil
+	}
+	c.lock.Unlock()
+
+	if !prepare {
+		return nil, errStatementNotCached
+	}
+
+	stmt, err := c.db.Preparex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.lock.Lock()
+	if e, ok := c.entries[query]; ok {
+		c.lru.MoveToFront(e)
+		entry := e.Value.(*statementCacheEntry)
+		entry.refs++
+		c.lock.Unlock()
+		stmt.Close()
+		return entry, nil
+	}
+
+	entry := &statementCacheEntry{query: query, stmt: stmt, refs: 1}
+	c.entries[query] = c.lru.PushFront(entry)
+	var evicted *sqlx.Stmt
+	if c.lru.Len() > c.capacity {
+		evicted = c.evictLocked(c.lru.Back())
+	}
+	c.lock.Unlock()
+
+	if evicted != nil {
+		evicted.Close()
+	}
+	return entry, nil
+}
+
+func (c *StatementCache) release(entry *statementCacheEntry) {
+	c.lock.Lock()
+	entry.refs--
+	closeNow := entry.evicted && entry.refs == 0
+	c.lock.Unlock()
+
+	if closeNow {
+		entry.stmt.Close()
+	}
+}
+
+// evictLocked removes e from the cache and returns its statement if nobody
+// is using it, so the caller can close it outside the lock.
+func (c *StatementCache) evictLocked(e *list.Element) *sqlx.Stmt {
+	entry := e.Value.(*statementCacheEntry)
+	c.lru.Remove(e)
+	delete(c.entries, entry.query)
+	entry.evicted = true
+	if entry.refs == 0 {
+		return entry.stmt
+	}
+	return nil
+}
+
+// withStatement runs prepared with the cached statement for query, or
+// unprepared if the statement cannot be prepared. When the server refuses to
+// prepare more statements it also empties the cache to release them.
+//
+// Transactions pass prepare as false: preparing a new statement takes a
+// connection of its own, which could deadlock a pool whose connections are
+// all held by transactions. database/sql keeps a statement's
+// connection-level resources alive until any rows it returned are closed,
+// so releasing the statement as soon as prepared returns is safe.
+func (c *StatementCache) withStatement(query string, prepare bool, prepared func(*sqlx.Stmt) error, unprepared func() error) error {
+	entry, err := c.acquire(query, prepare)
+	if err != nil {
+		if isMaxPreparedStmtCountReached(err) {
+			c.Purge()
+		}
+		return unprepared()
+	}
+
+	err = prepared(entry.stmt)
+	c.release(entry)
+	if isMaxPreparedStmtCountReached(err) {
+		c.Purge()
+		return unprepared()
+	}
+	return err
+}
+
+func isMaxPreparedStmtCountReached(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlMaxPreparedStmtCountReached
+}
@@ -0,0 +1,239 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+
+	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+	"code.cloudfoundry.org/cf-networking-helpers/db"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatementCache", func() {
+	var (
+		recorder *statementRecorder
+		conn     *db.ConnWrapper
+	)
+
+	BeforeEach(func() {
+		recorder = &statementRecorder{
+			prepared: map[string]int{},
+			closed:   map[string]int{},
+			direct:   map[string]int{},
+		}
+		sqlDB := sql.OpenDB(recorder)
+		sqlDB.SetMaxOpenConns(1)
+
+		conn = &db.ConnWrapper{
+			DB:      sqlx.NewDb(sqlDB, "mysql"),
+			Monitor: monitor.New(),
+		}
+		conn.EnableStatementCache(2)
+	})
+
+	AfterEach(func() {
+		conn.Close()
+	})
+
+	query := func(q string) {
+		rows, err := conn.Query(q)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Close()).To(Succeed())
+	}
+
+	It("prepares each query once and reuses it", func() {
+		query("SELECT 1")
+		query("SELECT 1")
+
+		var value int
+		Expect(conn.QueryRow("SELECT 1").Scan(&value)).To(Succeed())
+		Expect(value).To(Equal(1))
+
+		Expect(recorder.preparedCount("SELECT 1")).To(Equal(1))
+		Expect(recorder.directCount("SELECT 1")).To(Equal(0))
+		Expect(conn.StatementCache().Len()).To(Equal(1))
+	})
+
+	It("evicts and closes the least recently used statement", func() {
+		query("SELECT a")
+		query("SELECT b")
+		query("SELECT a")
+		query("SELECT c")
+
+		Expect(conn.StatementCache().Len()).To(Equal(2))
+		Expect(recorder.closedCount("SELECT b")).To(Equal(1))
+		Expect(recorder.closedCount("SELECT a")).To(Equal(0))
+
+		query("SELECT b")
+		Expect(recorder.preparedCount("SELECT b")).To(Equal(2))
+	})
+
+	It("closes every statement on purge", func() {
+		query("SELECT a")
+		query("SELECT b")
+
+		conn.StatementCache().Purge()
+
+		Expect(conn.StatementCache().Len()).To(Equal(0))
+		Expect(recorder.closedCount("SELECT a")).To(Equal(1))
+		Expect(recorder.closedCount("SELECT b")).To(Equal(1))
+	})
+
+	Context("in a transaction", func() {
+		It("reuses statements that are already cached", func() {
+			Expect(conn.StatementCache().Prepare("INSERT a")).To(Succeed())
+
+			tx, err := conn.Beginx()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = tx.Exec("INSERT a")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = tx.Exec("INSERT a")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tx.Commit()).To(Succeed())
+
+			Expect(recorder.preparedCount("INSERT a")).To(Equal(1))
+			Expect(recorder.directCount("INSERT a")).To(Equal(0))
+		})
+
+		It("runs uncached statements unprepared without taking another connection", func() {
+			tx, err := conn.Beginx()
+			Expect(err).NotTo(HaveOccurred())
+			_, err = tx.Exec("INSERT b")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tx.Commit()).To(Succeed())
+
+			Expect(recorder.preparedCount("INSERT b")).To(Equal(0))
+			Expect(recorder.directCount("INSERT b")).To(Equal(1))
+			Expect(conn.StatementCache().Len()).To(Equal(0))
+		})
+	})
+
+	Context("when the server has reached max_prepared_stmt_count", func() {
+		BeforeEach(func() {
+			query("SELECT a")
+			recorder.setPrepareError(&mysql.MySQLError{Number: 1461, Message: "Can't create more than max_prepared_stmt_count statements"})
+		})
+
+		It("releases the cached statements and runs the query unprepared", func() {
+			query("SELECT b")
+
+			Expect(conn.StatementCache().Len()).To(Equal(0))
+			Expect(recorder.closedCount("SELECT a")).To(Equal(1))
+			Expect(recorder.directCount("SELECT b")).To(Equal(1))
+		})
+	})
+})
+
+type statementRecorder struct {
+	lock       sync.Mutex
+	prepared   map[string]int
+	closed     map[string]int
+	direct     map[string]int
+	prepareErr error
+}
+
+func (r *statementRecorder) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{recorder: r}, nil
+}
+
+func (r *statementRecorder) Driver() driver.Driver {
+	return nil
+}
+
+func (r *statementRecorder) setPrepareError(err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.prepareErr = err
+}
+
+func (r *statementRecorder) count(counts map[string]int, query string) int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return counts[query]
+}
+
+func (r *statementRecorder) preparedCount(query string) int { return r.count(r.prepared, query) }
+func (r *statementRecorder) closedCount(query string) int   { return r.count(r.closed, query) }
+func (r *statementRecorder) directCount(query string) int   { return r.count(r.direct, query) }
+
+func (r *statementRecorder) record(counts map[string]int, query string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	counts[query]++
+}
+
+type recordingConn struct {
+	recorder *statementRecorder
+}
+
+func (c *recordingConn) Prepare(query string) (driver.Stmt, error) {
+	c.recorder.lock.Lock()
+	err := c.recorder.prepareErr
+	c.recorder.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	c.recorder.record(c.recorder.prepared, query)
+	return &recordingStmt{recorder: c.recorder, query: query}, nil
+}
+
+func (c *recordingConn) Close() error              { return nil }
+func (c *recordingConn) Begin() (driver.Tx, error) { return c, nil }
+func (c *recordingConn) Commit() error             { return nil }
+func (c *recordingConn) Rollback() error           { return nil }
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.recorder.record(c.recorder.direct, query)
+	return &oneRow{}, nil
+}
+
+func (c *recordingConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.recorder.record(c.recorder.direct, query)
+	return driver.RowsAffected(1), nil
+}
+
+type recordingStmt struct {
+	recorder *statementRecorder
+	query    string
+}
+
+func (s *recordingStmt) Close() error {
+	s.recorder.record(s.recorder.closed, s.query)
+	return nil
+}
+
+func (s *recordingStmt) NumInput() int {
+	return -1
+}
+
+func (s *recordingStmt) Exec([]driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+
+func (s *recordingStmt) Query([]driver.Value) (driver.Rows, error) {
+	return &oneRow{}, nil
+}
+
+type oneRow struct {
+	done bool
+}
+
+func (r *oneRow) Columns() []string { return []string{"value"} }
+func (r *oneRow) Close() error      { return nil }
+
+func (r *oneRow) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
@@ -24,6 +24,7 @@ var _ = Describe("Timeout", func() {
 	var (
 		dbConf   db.Config
 		ctx      context.Context
+		cancel   context.CancelFunc
 		database *db.ConnWrapper
 	)
 	dbConf = testsupport.GetDBConfig()
@@ -101,6 +102,10 @@ var _ = Describe("Timeout", func() {
 	}
 
 	AfterEach(func() {
+		if cancel != nil {
+			cancel()
+			cancel = nil
+		}
 		testsupport.RemoveDatabase(dbConf)
 	})
 
@@ -132,7 +137,7 @@ var _ = Describe("Timeout", func() {
 
 		Context("when the read timeout is greater than the context timeout and the database is unreachable", func() {
 			BeforeEach(func() {
-				ctx, _ = context.WithTimeout(context.Background(), 2*time.Second)
+				ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
 				dbConf.Timeout = 3
 				testsupport.CreateDatabase(dbConf)
 
@@ -211,7 +216,7 @@ var _ = Describe("Timeout", func() {
 
 			Context("when the context deadline is smaller than the connection string timeouts", func() {
 				BeforeEach(func() {
-					ctx, _ = context.WithTimeout(context.Background(), 500*time.Millisecond)
+					ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
 				})
 				Describe("QueryRowContext", func() {
 					expectContextDeadlineExceeded(queryRowContext)
@@ -0,0 +1,35 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+)
+
+// traced runs f as a client span that is a child of parent, or starts a new
+// trace if parent is nil. Without a recorder it only runs f.
+func traced(recorder tracing.SpanRecorder, parent *tracing.Span, name, query string, f func() error) error {
+	if recorder == nil {
+		return f()
+	}
+
+	span := tracing.StartSpan(name, tracing.SpanKindClient, parent)
+	if query != "" {
+		span.Attributes = map[string]string{"db.statement": query}
+	}
+	err := f()
+	span.End = time.Now()
+	span.Err = err
+	recorder.RecordSpan(span)
+	return err
+}
+
+// parentSpan returns the span in ctx, such as that of the HTTP request the
+// query is made for, or nil if there is none.
+func parentSpan(ctx context.Context) *tracing.Span {
+	if span, ok := tracing.SpanFromContext(ctx); ok {
+		return &span
+	}
+	return nil
+}
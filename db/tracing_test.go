@@ -0,0 +1,101 @@
+package db_test
+
+import (
+	"context"
+	"database/sql"
+
+	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+	"code.cloudfoundry.org/cf-networking-helpers/db"
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+	"github.com/jmoiron/sqlx"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tracing", func() {
+	var (
+		spans *fakes.SpanRecorder
+		conn  *db.ConnWrapper
+	)
+
+	BeforeEach(func() {
+		spans = &fakes.SpanRecorder{}
+		recorder := &statementRecorder{
+			prepared: map[string]int{},
+			closed:   map[string]int{},
+			direct:   map[string]int{},
+		}
+		conn = &db.ConnWrapper{
+			DB:      sqlx.NewDb(sql.OpenDB(recorder), "mysql"),
+			Monitor: monitor.New(),
+			Spans:   spans,
+		}
+	})
+
+	AfterEach(func() {
+		conn.Close()
+	})
+
+	It("records a span for each query", func() {
+		rows, err := conn.Query("SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Close()).To(Succeed())
+
+		Expect(spans.RecordSpanCallCount()).To(Equal(1))
+		span := spans.RecordSpanArgsForCall(0)
+		Expect(span.Name).To(Equal("db.query"))
+		Expect(span.Kind).To(Equal(tracing.SpanKindClient))
+		Expect(span.Attributes).To(HaveKeyWithValue("db.statement", "SELECT 1"))
+		Expect(span.ParentSpanID.IsValid()).To(BeFalse())
+	})
+
+	It("records queries as children of the span in the context", func() {
+		request := tracing.StartSpan("GET /policies", tracing.SpanKindServer, nil)
+		ctx := tracing.ContextWithSpan(context.Background(), request)
+
+		rows, err := conn.QueryContext(ctx, "SELECT 1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rows.Close()).To(Succeed())
+		conn.QueryRowContext(ctx, "SELECT 2").Scan()
+
+		Expect(spans.RecordSpanCallCount()).To(Equal(2))
+		for i := 0; i < 2; i++ {
+			span := spans.RecordSpanArgsForCall(i)
+			Expect(span.TraceID).To(Equal(request.TraceID))
+			Expect(span.ParentSpanID).To(Equal(request.SpanID))
+		}
+	})
+
+	It("records transactions as children of the span in the context", func() {
+		request := tracing.StartSpan("POST /policies", tracing.SpanKindServer, nil)
+		ctx := tracing.ContextWithSpan(context.Background(), request)
+
+		tx, err := conn.BeginTxx(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.Commit()).To(Succeed())
+
+		Expect(spans.RecordSpanCallCount()).To(Equal(1))
+		transaction := spans.RecordSpanArgsForCall(0)
+		Expect(transaction.TraceID).To(Equal(request.TraceID))
+		Expect(transaction.ParentSpanID).To(Equal(request.SpanID))
+	})
+
+	It("records transaction statements as children of the transaction", func() {
+		tx, err := conn.Beginx()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = tx.Exec("INSERT a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tx.Commit()).To(Succeed())
+		Expect(tx.Rollback()).NotTo(Succeed())
+
+		Expect(spans.RecordSpanCallCount()).To(Equal(2))
+		exec := spans.RecordSpanArgsForCall(0)
+		transaction := spans.RecordSpanArgsForCall(1)
+		Expect(exec.Name).To(Equal("db.exec"))
+		Expect(transaction.Name).To(Equal("db.transaction"))
+		Expect(exec.TraceID).To(Equal(transaction.TraceID))
+		Expect(exec.ParentSpanID).To(Equal(transaction.SpanID))
+	})
+})
@@ -0,0 +1,102 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+)
+
+type Db struct {
+	OpenConnectionsStub        func() int
+	openConnectionsMutex       sync.RWMutex
+	openConnectionsArgsForCall []struct {
+	}
+	openConnectionsReturns struct {
+		result1 int
+	}
+	openConnectionsReturnsOnCall map[int]struct {
+		result1 int
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *Db) OpenConnections() int {
+	fake.openConnectionsMutex.Lock()
+	ret, specificReturn := fake.openConnectionsReturnsOnCall[len(fake.openConnectionsArgsForCall)]
+	fake.openConnectionsArgsForCall = append(fake.openConnectionsArgsForCall, struct {
+	}{})
+	stub := fake.OpenConnectionsStub
+	fakeReturns := fake.openConnectionsReturns
+	fake.recordInvocation("OpenConnections", []interface{}{})
+	fake.openConnectionsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *Db) OpenConnectionsCallCount() int {
+	fake.openConnectionsMutex.RLock()
+	defer fake.openConnectionsMutex.RUnlock()
+	return len(fake.openConnectionsArgsForCall)
+}
+
+func (fake *Db) OpenConnectionsCalls(stub func() int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = stub
+}
+
+func (fake *Db) OpenConnectionsReturns(result1 int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = nil
+	fake.openConnectionsReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *Db) OpenConnectionsReturnsOnCall(i int, result1 int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = nil
+	if fake.openConnectionsReturnsOnCall == nil {
+		fake.openConnectionsReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.openConnectionsReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *Db) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.openConnectionsMutex.RLock()
+	defer fake.openConnectionsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *Db) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ metrics.Db = new(Db)
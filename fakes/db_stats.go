@@ -0,0 +1,168 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"database/sql"
+	"sync"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+)
+
+type DbStats struct {
+	OpenConnectionsStub        func() int
+	openConnectionsMutex       sync.RWMutex
+	openConnectionsArgsForCall []struct {
+	}
+	openConnectionsReturns struct {
+		result1 int
+	}
+	openConnectionsReturnsOnCall map[int]struct {
+		result1 int
+	}
+	StatsStub        func() sql.DBStats
+	statsMutex       sync.RWMutex
+	statsArgsForCall []struct {
+	}
+	statsReturns struct {
+		result1 sql.DBStats
+	}
+	statsReturnsOnCall map[int]struct {
+		result1 sql.DBStats
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *DbStats) OpenConnections() int {
+	fake.openConnectionsMutex.Lock()
+	ret, specificReturn := fake.openConnectionsReturnsOnCall[len(fake.openConnectionsArgsForCall)]
+	fake.openConnectionsArgsForCall = append(fake.openConnectionsArgsForCall, struct {
+	}{})
+	stub := fake.OpenConnectionsStub
+	fakeReturns := fake.openConnectionsReturns
+	fake.recordInvocation("OpenConnections", []interface{}{})
+	fake.openConnectionsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *DbStats) OpenConnectionsCallCount() int {
+	fake.openConnectionsMutex.RLock()
+	defer fake.openConnectionsMutex.RUnlock()
+	return len(fake.openConnectionsArgsForCall)
+}
+
+func (fake *DbStats) OpenConnectionsCalls(stub func() int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = stub
+}
+
+func (fake *DbStats) OpenConnectionsReturns(result1 int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = nil
+	fake.openConnectionsReturns = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *DbStats) OpenConnectionsReturnsOnCall(i int, result1 int) {
+	fake.openConnectionsMutex.Lock()
+	defer fake.openConnectionsMutex.Unlock()
+	fake.OpenConnectionsStub = nil
+	if fake.openConnectionsReturnsOnCall == nil {
+		fake.openConnectionsReturnsOnCall = make(map[int]struct {
+			result1 int
+		})
+	}
+	fake.openConnectionsReturnsOnCall[i] = struct {
+		result1 int
+	}{result1}
+}
+
+func (fake *DbStats) Stats() sql.DBStats {
+	fake.statsMutex.Lock()
+	ret, specificReturn := fake.statsReturnsOnCall[len(fake.statsArgsForCall)]
+	fake.statsArgsForCall = append(fake.statsArgsForCall, struct {
+	}{})
+	stub := fake.StatsStub
+	fakeReturns := fake.statsReturns
+	fake.recordInvocation("Stats", []interface{}{})
+	fake.statsMutex.Unlock()
+	if stub != nil {
+		return stub()
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *DbStats) StatsCallCount() int {
+	fake.statsMutex.RLock()
+	defer fake.statsMutex.RUnlock()
+	return len(fake.statsArgsForCall)
+}
+
+func (fake *DbStats) StatsCalls(stub func() sql.DBStats) {
+	fake.statsMutex.Lock()
+	defer fake.statsMutex.Unlock()
+	fake.StatsStub = stub
+}
+
+func (fake *DbStats) StatsReturns(result1 sql.DBStats) {
+	fake.statsMutex.Lock()
+	defer fake.statsMutex.Unlock()
+	fake.StatsStub = nil
+	fake.statsReturns = struct {
+		result1 sql.DBStats
+	}{result1}
+}
+
+func (fake *DbStats) StatsReturnsOnCall(i int, result1 sql.DBStats) {
+	fake.statsMutex.Lock()
+	defer fake.statsMutex.Unlock()
+	fake.StatsStub = nil
+	if fake.statsReturnsOnCall == nil {
+		fake.statsReturnsOnCall = make(map[int]struct {
+			result1 sql.DBStats
+		})
+	}
+	fake.statsReturnsOnCall[i] = struct {
+		result1 sql.DBStats
+	}{result1}
+}
+
+func (fake *DbStats) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.openConnectionsMutex.RLock()
+	defer fake.openConnectionsMutex.RUnlock()
+	fake.statsMutex.RLock()
+	defer fake.statsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *DbStats) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ metrics.DbStats = new(DbStats)
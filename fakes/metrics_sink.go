@@ -0,0 +1,268 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+)
+
+type MetricsSink struct {
+	AddToCounterStub        func(string, uint64) error
+	addToCounterMutex       sync.RWMutex
+	addToCounterArgsForCall []struct {
+		arg1 string
+		arg2 uint64
+	}
+	addToCounterReturns struct {
+		result1 error
+	}
+	addToCounterReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SendDurationStub        func(string, time.Duration) error
+	sendDurationMutex       sync.RWMutex
+	sendDurationArgsForCall []struct {
+		arg1 string
+		arg2 time.Duration
+	}
+	sendDurationReturns struct {
+		result1 error
+	}
+	sendDurationReturnsOnCall map[int]struct {
+		result1 error
+	}
+	SendGaugeStub        func(string, float64, string) error
+	sendGaugeMutex       sync.RWMutex
+	sendGaugeArgsForCall []struct {
+		arg1 string
+		arg2 float64
+		arg3 string
+	}
+	sendGaugeReturns struct {
+		result1 error
+	}
+	sendGaugeReturnsOnCall map[int]struct {
+		result1 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *MetricsSink) AddToCounter(arg1 string, arg2 uint64) error {
+	fake.addToCounterMutex.Lock()
+	ret, specificReturn := fake.addToCounterReturnsOnCall[len(fake.addToCounterArgsForCall)]
+	fake.addToCounterArgsForCall = append(fake.addToCounterArgsForCall, struct {
+		arg1 string
+		arg2 uint64
+	}{arg1, arg2})
+	stub := fake.AddToCounterStub
+	fakeReturns := fake.addToCounterReturns
+	fake.recordInvocation("AddToCounter", []interface{}{arg1, arg2})
+	fake.addToCounterMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *MetricsSink) AddToCounterCallCount() int {
+	fake.addToCounterMutex.RLock()
+	defer fake.addToCounterMutex.RUnlock()
+	return len(fake.addToCounterArgsForCall)
+}
+
+func (fake *MetricsSink) AddToCounterCalls(stub func(string, uint64) error) {
+	fake.addToCounterMutex.Lock()
+	defer fake.addToCounterMutex.Unlock()
+	fake.AddToCounterStub = stub
+}
+
+func (fake *MetricsSink) AddToCounterArgsForCall(i int) (string, uint64) {
+	fake.addToCounterMutex.RLock()
+	defer fake.addToCounterMutex.RUnlock()
+	argsForCall := fake.addToCounterArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *MetricsSink) AddToCounterReturns(result1 error) {
+	fake.addToCounterMutex.Lock()
+	defer fake.addToCounterMutex.Unlock()
+	fake.AddToCounterStub = nil
+	fake.addToCounterReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) AddToCounterReturnsOnCall(i int, result1 error) {
+	fake.addToCounterMutex.Lock()
+	defer fake.addToCounterMutex.Unlock()
+	fake.AddToCounterStub = nil
+	if fake.addToCounterReturnsOnCall == nil {
+		fake.addToCounterReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.addToCounterReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) SendDuration(arg1 string, arg2 time.Duration) error {
+	fake.sendDurationMutex.Lock()
+	ret, specificReturn := fake.sendDurationReturnsOnCall[len(fake.sendDurationArgsForCall)]
+	fake.sendDurationArgsForCall = append(fake.sendDurationArgsForCall, struct {
+		arg1 string
+		arg2 time.Duration
+	}{arg1, arg2})
+	stub := fake.SendDurationStub
+	fakeReturns := fake.sendDurationReturns
+	fake.recordInvocation("SendDuration", []interface{}{arg1, arg2})
+	fake.sendDurationMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *MetricsSink) SendDurationCallCount() int {
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	return len(fake.sendDurationArgsForCall)
+}
+
+func (fake *MetricsSink) SendDurationCalls(stub func(string, time.Duration) error) {
+	fake.sendDurationMutex.Lock()
+	defer fake.sendDurationMutex.Unlock()
+	fake.SendDurationStub = stub
+}
+
+func (fake *MetricsSink) SendDurationArgsForCall(i int) (string, time.Duration) {
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	argsForCall := fake.sendDurationArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *MetricsSink) SendDurationReturns(result1 error) {
+	fake.sendDurationMutex.Lock()
+	defer fake.sendDurationMutex.Unlock()
+	fake.SendDurationStub = nil
+	fake.sendDurationReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) SendDurationReturnsOnCall(i int, result1 error) {
+	fake.sendDurationMutex.Lock()
+	defer fake.sendDurationMutex.Unlock()
+	fake.SendDurationStub = nil
+	if fake.sendDurationReturnsOnCall == nil {
+		fake.sendDurationReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.sendDurationReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) SendGauge(arg1 string, arg2 float64, arg3 string) error {
+	fake.sendGaugeMutex.Lock()
+	ret, specificReturn := fake.sendGaugeReturnsOnCall[len(fake.sendGaugeArgsForCall)]
+	fake.sendGaugeArgsForCall = append(fake.sendGaugeArgsForCall, struct {
+		arg1 string
+		arg2 float64
+		arg3 string
+	}{arg1, arg2, arg3})
+	stub := fake.SendGaugeStub
+	fakeReturns := fake.sendGaugeReturns
+	fake.recordInvocation("SendGauge", []interface{}{arg1, arg2, arg3})
+	fake.sendGaugeMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *MetricsSink) SendGaugeCallCount() int {
+	fake.sendGaugeMutex.RLock()
+	defer fake.sendGaugeMutex.RUnlock()
+	return len(fake.sendGaugeArgsForCall)
+}
+
+func (fake *MetricsSink) SendGaugeCalls(stub func(string, float64, string) error) {
+	fake.sendGaugeMutex.Lock()
+	defer fake.sendGaugeMutex.Unlock()
+	fake.SendGaugeStub = stub
+}
+
+func (fake *MetricsSink) SendGaugeArgsForCall(i int) (string, float64, string) {
+	fake.sendGaugeMutex.RLock()
+	defer fake.sendGaugeMutex.RUnlock()
+	argsForCall := fake.sendGaugeArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *MetricsSink) SendGaugeReturns(result1 error) {
+	fake.sendGaugeMutex.Lock()
+	defer fake.sendGaugeMutex.Unlock()
+	fake.SendGaugeStub = nil
+	fake.sendGaugeReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) SendGaugeReturnsOnCall(i int, result1 error) {
+	fake.sendGaugeMutex.Lock()
+	defer fake.sendGaugeMutex.Unlock()
+	fake.SendGaugeStub = nil
+	if fake.sendGaugeReturnsOnCall == nil {
+		fake.sendGaugeReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.sendGaugeReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *MetricsSink) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.addToCounterMutex.RLock()
+	defer fake.addToCounterMutex.RUnlock()
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	fake.sendGaugeMutex.RLock()
+	defer fake.sendGaugeMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *MetricsSink) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ metrics.Sink = new(MetricsSink)
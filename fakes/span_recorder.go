@@ -0,0 +1,76 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+)
+
+type SpanRecorder struct {
+	RecordSpanStub        func(tracing.Span)
+	recordSpanMutex       sync.RWMutex
+	recordSpanArgsForCall []struct {
+		arg1 tracing.Span
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *SpanRecorder) RecordSpan(arg1 tracing.Span) {
+	fake.recordSpanMutex.Lock()
+	fake.recordSpanArgsForCall = append(fake.recordSpanArgsForCall, struct {
+		arg1 tracing.Span
+	}{arg1})
+	stub := fake.RecordSpanStub
+	fake.recordInvocation("RecordSpan", []interface{}{arg1})
+	fake.recordSpanMutex.Unlock()
+	if stub != nil {
+		fake.RecordSpanStub(arg1)
+	}
+}
+
+func (fake *SpanRecorder) RecordSpanCallCount() int {
+	fake.recordSpanMutex.RLock()
+	defer fake.recordSpanMutex.RUnlock()
+	return len(fake.recordSpanArgsForCall)
+}
+
+func (fake *SpanRecorder) RecordSpanCalls(stub func(tracing.Span)) {
+	fake.recordSpanMutex.Lock()
+	defer fake.recordSpanMutex.Unlock()
+	fake.RecordSpanStub = stub
+}
+
+func (fake *SpanRecorder) RecordSpanArgsForCall(i int) tracing.Span {
+	fake.recordSpanMutex.RLock()
+	defer fake.recordSpanMutex.RUnlock()
+	argsForCall := fake.recordSpanArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *SpanRecorder) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.recordSpanMutex.RLock()
+	defer fake.recordSpanMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *SpanRecorder) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ tracing.SpanRecorder = new(SpanRecorder)
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// Version and GitSHA identify the build. Set them with e.g.
+//
+//	-ldflags "-X code.cloudfoundry.org/cf-networking-helpers/metrics.Version=1.2.3
+//	          -X code.cloudfoundry.org/cf-networking-helpers/metrics.GitSHA=$(git rev-parse HEAD)"
+//
+// Otherwise NewBuildInfo falls back to what the Go toolchain recorded in the
+// binary.
+var (
+	Version string
+	GitSHA  string
+)
+
+type BuildInfo struct {
+	Version    string `json:"version"`
+	GitSHA     string `json:"git_sha"`
+	GoVersion  string `json:"go_version"`
+	ConfigHash string `json:"config_hash,omitempty"`
+}
+
+// NewBuildInfo describes the running binary. config is the job's effective
+// configuration, hashed with hashKey as by ConfigHash; pass nil to leave
+// ConfigHash out.
+func NewBuildInfo(config interface{}, hashKey []byte) (BuildInfo, error) {
+	info := BuildInfo{
+		Version:   Version,
+		GitSHA:    GitSHA,
+		GoVersion: runtime.Version(),
+	}
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+		if info.GitSHA == "" {
+			info.GitSHA = vcsRevision(buildInfo)
+		}
+	}
+
+	if config != nil {
+		hash, err := ConfigHash(config, hashKey)
+		if err != nil {
+			return BuildInfo{}, err
+		}
+		info.ConfigHash = hash
+	}
+	return info, nil
+}
+
+// ConfigHash is the hex HMAC-SHA-256 of config's JSON encoding. Instances
+// with the same effective configuration and key have the same hash. The hash
+// is published, so key must not be: without it, guesses at secrets in the
+// config cannot be checked against the hash.
+func ConfigHash(config interface{}, key []byte) (string, error) {
+	if len(key) == 0 {
+		return "", errors.New("hashing config: no key")
+	}
+	encoded, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("hashing config: %s", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// NewBuildInfoSource always reports 1, with the build info as tags, so that
+// dashboards can count instances per version or config hash.
+func NewBuildInfoSource(info BuildInfo) MetricSource {
+	tags := map[string]string{
+		"version":    info.Version,
+		"git_sha":    info.GitSHA,
+		"go_version": info.GoVersion,
+	}
+	if info.ConfigHash != "" {
+		tags["config_hash"] = info.ConfigHash
+	}
+
+	return MetricSource{
+		Name: "buildInfo",
+		Unit: "",
+		Tags: tags,
+		Getter: func() (float64, error) {
+			return 1, nil
+		},
+	}
+}
+
+// ServeHTTP serves the build info as JSON.
+func (info BuildInfo) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
@@ -0,0 +1,17 @@
+//go:build go1.18
+// +build go1.18
+
+package metrics
+
+import "runtime/debug"
+
+// vcsRevision is the commit the toolchain recorded the binary was built
+// from, which Go 1.18 and later do.
+func vcsRevision(buildInfo *debug.BuildInfo) string {
+	for _, setting := range buildInfo.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,10 @@
+//go:build !go1.18
+// +build !go1.18
+
+package metrics
+
+import "runtime/debug"
+
+func vcsRevision(*debug.BuildInfo) string {
+	return ""
+}
@@ -0,0 +1,109 @@
+package metrics_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BuildInfo", func() {
+	type config struct {
+		ListenPort int    `json:"listen_port"`
+		Database   string `json:"database"`
+	}
+
+	BeforeEach(func() {
+		metrics.Version = "1.2.3"
+		metrics.GitSHA = "abc123"
+	})
+
+	AfterEach(func() {
+		metrics.Version = ""
+		metrics.GitSHA = ""
+	})
+
+	key := []byte("shared-secret")
+
+	It("reports the ldflags variables, the Go version and the config hash", func() {
+		info, err := metrics.NewBuildInfo(config{ListenPort: 8080}, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(info.Version).To(Equal("1.2.3"))
+		Expect(info.GitSHA).To(Equal("abc123"))
+		Expect(info.GoVersion).To(Equal(runtime.Version()))
+		Expect(info.ConfigHash).To(HaveLen(64))
+	})
+
+	It("hashes equal configs alike and different configs differently", func() {
+		a, err := metrics.ConfigHash(config{ListenPort: 8080, Database: "policy"}, key)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := metrics.ConfigHash(config{ListenPort: 8080, Database: "policy"}, key)
+		Expect(err).NotTo(HaveOccurred())
+		c, err := metrics.ConfigHash(config{ListenPort: 8081, Database: "policy"}, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(a).To(Equal(b))
+		Expect(a).NotTo(Equal(c))
+	})
+
+	It("hashes with the key, so that the config cannot be guessed from the hash", func() {
+		encoded, err := json.Marshal(config{ListenPort: 8080, Database: "policy"})
+		Expect(err).NotTo(HaveOccurred())
+		plain := sha256.Sum256(encoded)
+
+		a, err := metrics.ConfigHash(config{ListenPort: 8080, Database: "policy"}, key)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := metrics.ConfigHash(config{ListenPort: 8080, Database: "policy"}, []byte("other-secret"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(a).NotTo(Equal(hex.EncodeToString(plain[:])))
+		Expect(a).NotTo(Equal(b))
+	})
+
+	It("fails without a key", func() {
+		_, err := metrics.NewBuildInfo(config{}, nil)
+		Expect(err).To(MatchError("hashing config: no key"))
+	})
+
+	It("fails for configs that cannot be encoded", func() {
+		_, err := metrics.NewBuildInfo(map[string]interface{}{"f": func() {}}, key)
+		Expect(err).To(MatchError(ContainSubstring("hashing config")))
+	})
+
+	It("is published as a source tagged with the build info", func() {
+		info, err := metrics.NewBuildInfo(nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		source := metrics.NewBuildInfoSource(info)
+		Expect(source.Name).To(Equal("buildInfo"))
+		Expect(source.Tags).To(Equal(map[string]string{
+			"version":    "1.2.3",
+			"git_sha":    "abc123",
+			"go_version": runtime.Version(),
+		}))
+		Expect(source.Getter()).To(Equal(1.0))
+	})
+
+	It("is served as JSON", func() {
+		info, err := metrics.NewBuildInfo(config{}, key)
+		Expect(err).NotTo(HaveOccurred())
+
+		resp := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/build-info", nil)
+		Expect(err).NotTo(HaveOccurred())
+		info.ServeHTTP(resp, request)
+
+		Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+		var served metrics.BuildInfo
+		Expect(json.Unmarshal(resp.Body.Bytes(), &served)).To(Succeed())
+		Expect(served).To(Equal(info))
+	})
+})
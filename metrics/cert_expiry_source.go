@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const DefaultCertExpiryWarnThreshold = 30 * 24 * time.Hour
+
+// NewCertExpirySources report the seconds until the soonest expiring
+// certificate in each PEM file expires, tagged with the file's path, e.g. for
+// the files given to mutualtls or db.Config.CACert. Files are read on every
+// emit, so rotated certificates are picked up. When a file's expiry comes
+// within warnThreshold it is logged once as an error, as lager has no
+// warning level, and again if it crosses the threshold after a rotation.
+// The sources share a name, so an emitter needs SetAllowSharedNames to
+// register them.
+func NewCertExpirySources(logger lager.Logger, warnThreshold time.Duration, paths ...string) []MetricSource {
+	if warnThreshold <= 0 {
+		warnThreshold = DefaultCertExpiryWarnThreshold
+	}
+
+	sources := make([]MetricSource, 0, len(paths))
+	for _, path := range paths {
+		sources = append(sources, certExpirySource(logger, warnThreshold, path))
+	}
+	return sources
+}
+
+func certExpirySource(logger lager.Logger, warnThreshold time.Duration, path string) MetricSource {
+	var (
+		lock   sync.Mutex
+		warned bool
+	)
+
+	return MetricSource{
+		Name: "certExpiry",
+		Unit: "seconds",
+		Tags: map[string]string{"file": path},
+		Getter: func() (float64, error) {
+			notAfter, err := soonestExpiry(path)
+			if err != nil {
+				return 0, err
+			}
+			remaining := time.Until(notAfter)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if remaining >= warnThreshold {
+				warned = false
+			} else if !warned {
+				warned = true
+				logger.Error("certificate-expiring-soon", fmt.Errorf("certificate expires in %s", remaining.Round(time.Second)), lager.Data{
+					"file":      path,
+					"not-after": notAfter.UTC().Format(time.RFC3339),
+				})
+			}
+			return remaining.Seconds(), nil
+		},
+	}
+}
+
+func soonestExpiry(path string) (time.Time, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading certificate file: %s", err)
+	}
+
+	var soonest time.Time
+	for {
+		var block *pem.Block
+		block, contents = pem.Decode(contents)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("parsing certificate in %s: %s", path, err)
+		}
+		if soonest.IsZero() || cert.NotAfter.Before(soonest) {
+			soonest = cert.NotAfter
+		}
+	}
+
+	if soonest.IsZero() {
+		return time.Time{}, fmt.Errorf("no certificates in %s", path)
+	}
+	return soonest, nil
+}
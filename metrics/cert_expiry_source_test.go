@@ -0,0 +1,135 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("CertExpirySources", func() {
+	const day = 24 * time.Hour
+
+	var (
+		certDir    string
+		caCertPath string
+		certPath   string
+		logger     *lagertest.TestLogger
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "cert-expiry")
+		Expect(err).NotTo(HaveOccurred())
+
+		certWriter, err := testsupport.NewCertWriter(certDir)
+		Expect(err).NotTo(HaveOccurred())
+		caCertPath, err = certWriter.WriteCA("some-ca")
+		Expect(err).NotTo(HaveOccurred())
+		certPath, _, err = certWriter.WriteAndSign("some-server", "some-ca")
+		Expect(err).NotTo(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(certDir)
+	})
+
+	value := func(source metrics.MetricSource) float64 {
+		v, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	It("reports the seconds until each file's certificate expires", func() {
+		sources := metrics.NewCertExpirySources(logger, 0, caCertPath, certPath)
+		Expect(sources).To(HaveLen(2))
+
+		Expect(sources[0].Name).To(Equal("certExpiry"))
+		Expect(sources[0].Unit).To(Equal("seconds"))
+		Expect(sources[0].Tags).To(Equal(map[string]string{"file": caCertPath}))
+		Expect(value(sources[0])).To(BeNumerically("~", (5 * 365 * day).Seconds(), (3 * day).Seconds()))
+		Expect(value(sources[1])).To(BeNumerically("~", (365 * day).Seconds(), (3 * day).Seconds()))
+	})
+
+	It("reports the soonest expiring certificate of a bundle", func() {
+		ca, err := ioutil.ReadFile(caCertPath)
+		Expect(err).NotTo(HaveOccurred())
+		cert, err := ioutil.ReadFile(certPath)
+		Expect(err).NotTo(HaveOccurred())
+		bundlePath := filepath.Join(certDir, "bundle.crt")
+		Expect(ioutil.WriteFile(bundlePath, append(ca, cert...), 0600)).To(Succeed())
+
+		source := metrics.NewCertExpirySources(logger, 0, bundlePath)[0]
+		Expect(value(source)).To(BeNumerically("~", (365 * day).Seconds(), (3 * day).Seconds()))
+	})
+
+	It("logs once when the expiry is within the threshold", func() {
+		source := metrics.NewCertExpirySources(logger, 2*365*day, caCertPath, certPath)[1]
+		value(source)
+		value(source)
+
+		Expect(logger.LogMessages()).To(Equal([]string{"test.certificate-expiring-soon"}))
+		Expect(logger.Logs()[0].Data).To(HaveKeyWithValue("file", certPath))
+	})
+
+	It("does not log for certificates that expire later", func() {
+		source := metrics.NewCertExpirySources(logger, 2*365*day, caCertPath)[0]
+		value(source)
+		Expect(logger.LogMessages()).To(BeEmpty())
+	})
+
+	It("fails for missing files and files without certificates", func() {
+		emptyPath := filepath.Join(certDir, "empty.crt")
+		Expect(ioutil.WriteFile(emptyPath, []byte("potato"), 0600)).To(Succeed())
+
+		sources := metrics.NewCertExpirySources(logger, 0, filepath.Join(certDir, "missing.crt"), emptyPath)
+		_, err := sources[0].Getter()
+		Expect(err).To(MatchError(ContainSubstring("reading certificate file")))
+		_, err = sources[1].Getter()
+		Expect(err).To(MatchError(ContainSubstring("no certificates in")))
+	})
+
+	It("can be registered together on a running emitter", func() {
+		missingPath := filepath.Join(certDir, "missing.crt")
+		sink := &fakes.MetricsSink{}
+		emitter := metrics.NewMetricsEmitterWithSink(logger, time.Hour, sink)
+		emitter.SetAllowSharedNames(true)
+		process := ifrit.Invoke(emitter)
+		defer func() {
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		}()
+
+		for _, source := range metrics.NewCertExpirySources(logger, 0, caCertPath, certPath, missingPath) {
+			Expect(emitter.Register(source)).To(Succeed())
+		}
+		emitter.EmitMetrics()
+
+		gauges := []string{}
+		for i := 0; i < sink.SendGaugeCallCount(); i++ {
+			name, _, _ := sink.SendGaugeArgsForCall(i)
+			gauges = append(gauges, name)
+		}
+		Expect(gauges).To(ConsistOf("certExpiry;file="+caCertPath, "certExpiry;file="+certPath))
+
+		Expect(sink.AddToCounterCallCount()).To(Equal(1))
+		name, _ := sink.AddToCounterArgsForCall(0)
+		Expect(name).To(Equal(metrics.GetterErrorsMetric + ";file=" + missingPath + ";source=certExpiry"))
+		Expect(logger).To(gbytes.Say("metric-getter.*certExpiry;file=" + missingPath))
+
+		Expect(emitter.Unregister("certExpiry", map[string]string{"file": missingPath}, false)).To(Succeed())
+		Expect(emitter.Unregister("certExpiry", nil, false)).To(MatchError(`metric source "certExpiry" is not registered`))
+	})
+})
@@ -1,13 +1,30 @@
 package metrics
 
-import "code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+import (
+	"database/sql"
+	"sync"
 
+	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+)
+
+//go:generate counterfeiter -o ../fakes/db.go --fake-name Db . Db
 type Db interface {
 	OpenConnections() int
 }
 
+// DbStats is a Db that reports the pool stats of database/sql, such as
+// *db.ConnWrapper.
+//
+//go:generate counterfeiter -o ../fakes/db_stats.go --fake-name DbStats . DbStats
+type DbStats interface {
+	Db
+	Stats() sql.DBStats
+}
+
+// NewDBMonitorSource reports open connections and the query monitor values,
+// and the connection pool stats if Db is a DbStats.
 func NewDBMonitorSource(Db Db, monitor monitor.Monitor) []MetricSource {
-	return []MetricSource{
+	sources := []MetricSource{
 		{
 			Name: "DBOpenConnections",
 			Unit: "",
@@ -51,4 +68,89 @@ func NewDBMonitorSource(Db Db, monitor monitor.Monitor) []MetricSource {
 			},
 		},
 	}
+
+	dbStats, ok := Db.(DbStats)
+	if !ok {
+		return sources
+	}
+
+	stats := &statsSnapshot{db: dbStats}
+	// The pool's wait totals start with the pool, so the first emit reports
+	// all of them.
+	waitCount := &deltaTracker{started: true}
+	waitDuration := &deltaTracker{started: true}
+	return append(sources, []MetricSource{
+		{
+			Name: "DBConnectionsInUse",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(stats.get("DBConnectionsInUse").InUse), nil
+			},
+		},
+		{
+			Name: "DBConnectionsIdle",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(stats.get("DBConnectionsIdle").Idle), nil
+			},
+		},
+		{
+			Name: "DBConnectionsMaxOpen",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(stats.get("DBConnectionsMaxOpen").MaxOpenConnections), nil
+			},
+		},
+		{
+			Name: "DBConnectionsWaitCount",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return waitCount.delta(float64(stats.get("DBConnectionsWaitCount").WaitCount)), nil
+			},
+		},
+		{
+			Name: "DBConnectionsWaitDuration",
+			Unit: "seconds",
+			Getter: func() (float64, error) {
+				return waitDuration.delta(stats.get("DBConnectionsWaitDuration").WaitDuration.Seconds()), nil
+			},
+		},
+		{
+			Name: "DBConnectionsMaxIdleClosed",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(stats.get("DBConnectionsMaxIdleClosed").MaxIdleClosed), nil
+			},
+		},
+		{
+			Name: "DBConnectionsMaxLifetimeClosed",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(stats.get("DBConnectionsMaxLifetimeClosed").MaxLifetimeClosed), nil
+			},
+		},
+	}...)
+}
+
+// statsSnapshot shares one call to Stats between the pool stats sources of
+// an emit, so that they are consistent with each other. A source reading
+// the snapshot a second time takes a new one.
+type statsSnapshot struct {
+	db DbStats
+
+	lock  sync.Mutex
+	stats sql.DBStats
+	read  map[string]bool
+}
+
+func (s *statsSnapshot) get(source string) sql.DBStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.read == nil || s.read[source] {
+		s.stats = s.db.Stats()
+		s.read = map[string]bool{}
+	}
+	s.read[source] = true
+	return s.stats
 }
@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"database/sql"
+	"time"
+
+	"code.cloudfoundry.org/bbs/db/sqldb/helpers/monitor"
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DBMonitorSource", func() {
+	var (
+		fakeDb  *fakes.DbStats
+		sources map[string]metrics.MetricSource
+	)
+
+	getValue := func(name string) float64 {
+		source, ok := sources[name]
+		Expect(ok).To(BeTrue(), "missing source %s", name)
+		value, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	BeforeEach(func() {
+		fakeDb = &fakes.DbStats{}
+		fakeDb.OpenConnectionsReturns(7)
+		fakeDb.StatsReturns(sql.DBStats{
+			MaxOpenConnections: 20,
+			OpenConnections:    7,
+			InUse:              5,
+			Idle:               2,
+			WaitCount:          10,
+			WaitDuration:       3 * time.Second,
+			MaxIdleClosed:      4,
+			MaxLifetimeClosed:  6,
+		})
+
+		sources = map[string]metrics.MetricSource{}
+		for _, source := range metrics.NewDBMonitorSource(fakeDb, monitor.New()) {
+			sources[source.Name] = source
+		}
+	})
+
+	It("reports the connection pool stats", func() {
+		Expect(getValue("DBOpenConnections")).To(Equal(7.0))
+		Expect(getValue("DBConnectionsInUse")).To(Equal(5.0))
+		Expect(getValue("DBConnectionsIdle")).To(Equal(2.0))
+		Expect(getValue("DBConnectionsMaxOpen")).To(Equal(20.0))
+		Expect(getValue("DBConnectionsMaxIdleClosed")).To(Equal(4.0))
+		Expect(getValue("DBConnectionsMaxLifetimeClosed")).To(Equal(6.0))
+	})
+
+	It("reports the wait counters as deltas since the last read", func() {
+		Expect(getValue("DBConnectionsWaitCount")).To(Equal(10.0))
+		Expect(getValue("DBConnectionsWaitDuration")).To(Equal(3.0))
+
+		fakeDb.StatsReturns(sql.DBStats{
+			WaitCount:    15,
+			WaitDuration: 4500 * time.Millisecond,
+		})
+
+		Expect(getValue("DBConnectionsWaitCount")).To(Equal(5.0))
+		Expect(getValue("DBConnectionsWaitDuration")).To(Equal(1.5))
+
+		Expect(getValue("DBConnectionsWaitCount")).To(Equal(0.0))
+		Expect(getValue("DBConnectionsWaitDuration")).To(Equal(0.0))
+	})
+
+	It("reads the stats once per round of getters", func() {
+		for _, source := range sources {
+			_, err := source.Getter()
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(fakeDb.StatsCallCount()).To(Equal(1))
+
+		for _, source := range sources {
+			_, err := source.Getter()
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(fakeDb.StatsCallCount()).To(Equal(2))
+	})
+
+	Context("when the Db does not report stats", func() {
+		It("only reports open connections and the query monitor values", func() {
+			names := []string{}
+			for _, source := range metrics.NewDBMonitorSource(&fakes.Db{}, monitor.New()) {
+				names = append(names, source.Name)
+			}
+			Expect(names).To(ConsistOf("DBOpenConnections", "DBQueriesTotal", "DBQueriesSucceeded",
+				"DBQueriesFailed", "DBQueriesInFlight", "DBQueryDurationMax"))
+		})
+	})
+
+	It("reports the query monitor values", func() {
+		Expect(sources).To(HaveKey("DBQueriesTotal"))
+		Expect(sources).To(HaveKey("DBQueriesSucceeded"))
+		Expect(sources).To(HaveKey("DBQueriesFailed"))
+		Expect(sources).To(HaveKey("DBQueriesInFlight"))
+		Expect(sources["DBQueryDurationMax"].Unit).To(Equal("seconds"))
+	})
+})
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+)
+
+// The sources below derive values from sources that report monotonically
+// increasing totals, such as DBQueriesTotal. The first emit only reads the
+// totals and reports 0, so that later emits report the increase since then
+// rather than the lifetime total. A total that goes down was
+// reset, e.g. because the process that owns it restarted, and is counted
+// again from zero.
+
+// NewDeltaSource reports how much source increased since the last emit.
+func NewDeltaSource(name string, source MetricSource) MetricSource {
+	tracker := &deltaTracker{}
+	return MetricSource{
+		Name:    name,
+		Unit:    source.Unit,
+		Tags:    source.Tags,
+		Timeout: source.Timeout,
+		Getter: func() (float64, error) {
+			current, err := source.Getter()
+			if err != nil {
+				return 0, err
+			}
+			return tracker.delta(current), nil
+		},
+	}
+}
+
+// NewRateSource reports the per-second increase of source since the last
+// emit.
+func NewRateSource(name, unit string, source MetricSource) MetricSource {
+	return NewRateSourceWithClock(name, unit, source, clock.NewClock())
+}
+
+func NewRateSourceWithClock(name, unit string, source MetricSource, clock clock.Clock) MetricSource {
+	tracker := &deltaTracker{}
+	lastRead := clock.Now()
+	var lock sync.Mutex
+
+	return MetricSource{
+		Name:    name,
+		Unit:    unit,
+		Tags:    source.Tags,
+		Timeout: source.Timeout,
+		Getter: func() (float64, error) {
+			current, err := source.Getter()
+			if err != nil {
+				return 0, err
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			now := clock.Now()
+			elapsed := now.Sub(lastRead).Seconds()
+			lastRead = now
+
+			delta := tracker.delta(current)
+			if elapsed <= 0 {
+				return 0, nil
+			}
+			return delta / elapsed, nil
+		},
+	}
+}
+
+// NewRatioSource reports the increase of numerator divided by the increase
+// of denominator since the last emit, e.g. failed over total queries. It
+// reports 0 when the denominator did not increase.
+func NewRatioSource(name string, numerator, denominator MetricSource) MetricSource {
+	numeratorTracker := &deltaTracker{}
+	denominatorTracker := &deltaTracker{}
+	var lock sync.Mutex
+
+	// Both getters are called in turn, so each may take up to its timeout.
+	var timeout time.Duration
+	if numerator.Timeout > 0 && denominator.Timeout > 0 {
+		timeout = numerator.Timeout + denominator.Timeout
+	}
+
+	return MetricSource{
+		Name:    name,
+		Unit:    "",
+		Tags:    MergeTags(denominator.Tags, numerator.Tags),
+		Timeout: timeout,
+		Getter: func() (float64, error) {
+			n, err := numerator.Getter()
+			if err != nil {
+				return 0, err
+			}
+			d, err := denominator.Getter()
+			if err != nil {
+				return 0, err
+			}
+
+			lock.Lock()
+			defer lock.Unlock()
+			nDelta := numeratorTracker.delta(n)
+			dDelta := denominatorTracker.delta(d)
+			if dDelta <= 0 {
+				return 0, nil
+			}
+			return nDelta / dDelta, nil
+		},
+	}
+}
+
+// deltaTracker turns a cumulative value into the change since it was last
+// read. The first value is the baseline, with no change. A value lower than
+// the last one means the total was reset, so all of it is new.
+type deltaTracker struct {
+	lock    sync.Mutex
+	last    float64
+	started bool
+}
+
+func (d *deltaTracker) delta(current float64) float64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.started {
+		d.started = true
+		d.last = current
+		return 0
+	}
+	delta := current - d.last
+	if delta < 0 {
+		delta = current
+	}
+	d.last = current
+	return delta
+}
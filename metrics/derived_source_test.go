@@ -0,0 +1,156 @@
+package metrics_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/clock/fakeclock"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Derived sources", func() {
+	var (
+		total, failed float64
+		totalErr      error
+		totalSource   metrics.MetricSource
+		failedSource  metrics.MetricSource
+	)
+
+	value := func(source metrics.MetricSource) float64 {
+		v, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	BeforeEach(func() {
+		total, failed, totalErr = 0, 0, nil
+		totalSource = metrics.MetricSource{
+			Name:   "DBQueriesTotal",
+			Tags:   map[string]string{"database": "policy"},
+			Getter: func() (float64, error) { return total, totalErr },
+		}
+		failedSource = metrics.MetricSource{
+			Name:   "DBQueriesFailed",
+			Getter: func() (float64, error) { return failed, nil },
+		}
+	})
+
+	Describe("NewDeltaSource", func() {
+		It("reports the increase since the last emit", func() {
+			source := metrics.NewDeltaSource("DBQueries", totalSource)
+			Expect(source.Name).To(Equal("DBQueries"))
+			Expect(source.Tags).To(Equal(map[string]string{"database": "policy"}))
+
+			total = 10
+			Expect(value(source)).To(Equal(0.0))
+			total = 15
+			Expect(value(source)).To(Equal(5.0))
+			Expect(value(source)).To(Equal(0.0))
+		})
+
+		It("starts from the total it first reads", func() {
+			total = 100
+			source := metrics.NewDeltaSource("DBQueries", totalSource)
+
+			total = 200
+			Expect(value(source)).To(Equal(0.0))
+			total = 204
+			Expect(value(source)).To(Equal(4.0))
+		})
+
+		It("does not read the total until it is read itself", func() {
+			calls := 0
+			totalSource.Getter = func() (float64, error) {
+				calls++
+				return total, nil
+			}
+			source := metrics.NewDeltaSource("DBQueries", totalSource)
+			Expect(calls).To(Equal(0))
+
+			value(source)
+			Expect(calls).To(Equal(1))
+		})
+
+		It("counts a total that went down from zero", func() {
+			source := metrics.NewDeltaSource("DBQueries", totalSource)
+			total = 10
+			value(source)
+
+			total = 3
+			Expect(value(source)).To(Equal(3.0))
+			total = 4
+			Expect(value(source)).To(Equal(1.0))
+		})
+
+		It("returns the error of the wrapped source", func() {
+			source := metrics.NewDeltaSource("DBQueries", totalSource)
+			total = 10
+			totalErr = errors.New("potato")
+			_, err := source.Getter()
+			Expect(err).To(MatchError("potato"))
+
+			totalErr = nil
+			Expect(value(source)).To(Equal(0.0))
+			total = 12
+			Expect(value(source)).To(Equal(2.0))
+		})
+	})
+
+	Describe("NewRateSource", func() {
+		It("reports the increase per second", func() {
+			clock := fakeclock.NewFakeClock(time.Now())
+			total = 50
+			source := metrics.NewRateSourceWithClock("DBQueriesRate", "perSecond", totalSource, clock)
+			Expect(source.Unit).To(Equal("perSecond"))
+			Expect(value(source)).To(Equal(0.0))
+
+			clock.Increment(200 * time.Millisecond)
+			total = 70
+			Expect(value(source)).To(Equal(100.0))
+
+			clock.Increment(2 * time.Second)
+			total = 5
+			Expect(value(source)).To(Equal(2.5))
+		})
+	})
+
+	Describe("NewRatioSource", func() {
+		It("reports the ratio of the increases", func() {
+			source := metrics.NewRatioSource("DBQueriesErrorRatio", failedSource, totalSource)
+			Expect(source.Tags).To(Equal(map[string]string{"database": "policy"}))
+
+			total, failed = 10, 1
+			Expect(value(source)).To(Equal(0.0))
+
+			total, failed = 20, 2
+			Expect(value(source)).To(Equal(0.1))
+
+			total, failed = 24, 4
+			Expect(value(source)).To(Equal(0.5))
+		})
+
+		It("starts from the totals it first reads", func() {
+			source := metrics.NewRatioSource("DBQueriesErrorRatio", failedSource, totalSource)
+
+			total, failed = 1000, 500
+			Expect(value(source)).To(Equal(0.0))
+			total, failed = 1010, 501
+			Expect(value(source)).To(Equal(0.1))
+		})
+
+		It("allows for both getters' timeouts", func() {
+			failedSource.Timeout = time.Second
+			totalSource.Timeout = 2 * time.Second
+			source := metrics.NewRatioSource("DBQueriesErrorRatio", failedSource, totalSource)
+			Expect(source.Timeout).To(Equal(3 * time.Second))
+		})
+
+		It("reports 0 when the denominator did not increase", func() {
+			source := metrics.NewRatioSource("DBQueriesErrorRatio", failedSource, totalSource)
+			Expect(value(source)).To(Equal(0.0))
+		})
+	})
+})
@@ -0,0 +1,73 @@
+package metrics
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+// DefaultErrorLogInterval is how often MetricsSender and MetricsEmitter log
+// an error that keeps recurring.
+const DefaultErrorLogInterval = 10 * time.Second
+
+// errorLog rate-limits errors that repeat, e.g. every send failing while
+// metron is unreachable. An error with the same key and type is logged at
+// most once per interval, along with how many were suppressed since it was
+// last logged. Messages are left out of the key as they often vary, e.g.
+// with addresses or counts. Keys not logged for an interval are forgotten.
+// The zero value is ready to use.
+type errorLog struct {
+	lock       sync.Mutex
+	last       map[string]time.Time
+	suppressed map[string]uint64
+	swept      time.Time
+}
+
+func (l *errorLog) Error(logger lager.Logger, interval time.Duration, key, action string, err error, data lager.Data) {
+	if interval <= 0 {
+		interval = DefaultErrorLogInterval
+	}
+
+	key += ": " + fmt.Sprintf("%T", err)
+
+	l.lock.Lock()
+	if l.last == nil {
+		l.last = map[string]time.Time{}
+		l.suppressed = map[string]uint64{}
+	}
+	now := time.Now()
+	if last, ok := l.last[key]; ok && now.Sub(last) < interval {
+		l.suppressed[key]++
+		l.lock.Unlock()
+		return
+	}
+	suppressed := l.suppressed[key]
+	l.last[key] = now
+	delete(l.suppressed, key)
+	l.sweepLocked(now, interval)
+	l.lock.Unlock()
+
+	logData := lager.Data{}
+	for k, v := range data {
+		logData[k] = v
+	}
+	if suppressed > 0 {
+		logData["suppressed"] = suppressed
+	}
+	logger.Error(action, err, logData)
+}
+
+func (l *errorLog) sweepLocked(now time.Time, interval time.Duration) {
+	if now.Sub(l.swept) < interval {
+		return
+	}
+	for key, last := range l.last {
+		if now.Sub(last) >= interval {
+			delete(l.last, key)
+			delete(l.suppressed, key)
+		}
+	}
+	l.swept = now
+}
@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// histogramGrowth is the ratio between the bounds of neighbouring buckets.
+// Percentiles are reported as the middle of their bucket, so they are off by
+// at most about 2.5%.
+const histogramGrowth = 1.05
+
+var logHistogramGrowth = math.Log(histogramGrowth)
+
+// Histogram aggregates durations in-process so that a MetricsEmitter can
+// report their count, sum, percentiles and max once per interval instead of
+// sending every observation.
+type Histogram struct {
+	name string
+	tags map[string]string
+
+	lock    sync.Mutex
+	buckets map[int]uint64
+	count   uint64
+	sum     time.Duration
+	max     time.Duration
+}
+
+type HistogramSnapshot struct {
+	Count uint64
+	Sum   time.Duration
+	P50   time.Duration
+	P95   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func NewHistogram(name string, tags map[string]string) *Histogram {
+	return &Histogram{
+		name:    name,
+		tags:    tags,
+		buckets: map[int]uint64{},
+	}
+}
+
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+func (h *Histogram) Observe(duration time.Duration) {
+	if duration < 0 {
+		duration = 0
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.buckets[histogramBucket(duration)]++
+	h.count++
+	h.sum += duration
+	if duration > h.max {
+		h.max = duration
+	}
+}
+
+// Flush returns what was observed since the last flush and starts over.
+func (h *Histogram) Flush() HistogramSnapshot {
+	h.lock.Lock()
+	buckets, count, sum, max := h.buckets, h.count, h.sum, h.max
+	h.buckets, h.count, h.sum, h.max = map[int]uint64{}, 0, 0, 0
+	h.lock.Unlock()
+
+	snapshot := HistogramSnapshot{Count: count, Sum: sum, Max: max}
+	if count == 0 {
+		return snapshot
+	}
+
+	indexes := make([]int, 0, len(buckets))
+	for index := range buckets {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	percentile := func(p float64) time.Duration {
+		rank := uint64(math.Ceil(p * float64(count)))
+		var seen uint64
+		for _, index := range indexes {
+			seen += buckets[index]
+			if seen >= rank {
+				if value := histogramValue(index); value < max {
+					return value
+				}
+				return max
+			}
+		}
+		return max
+	}
+
+	snapshot.P50 = percentile(0.50)
+	snapshot.P95 = percentile(0.95)
+	snapshot.P99 = percentile(0.99)
+	return snapshot
+}
+
+// histogramBucket indexes durations of one microsecond and less as bucket
+// 0; each following bucket is histogramGrowth times wider.
+func histogramBucket(duration time.Duration) int {
+	micros := float64(duration) / float64(time.Microsecond)
+	if micros <= 1 {
+		return 0
+	}
+	return int(math.Log(micros)/logHistogramGrowth) + 1
+}
+
+func histogramValue(index int) time.Duration {
+	if index == 0 {
+		return time.Microsecond
+	}
+	lower := math.Pow(histogramGrowth, float64(index-1))
+	return time.Duration(lower * (1 + histogramGrowth) / 2 * float64(time.Microsecond))
+}
@@ -0,0 +1,98 @@
+package metrics_test
+
+import (
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Histogram", func() {
+	var histogram *metrics.Histogram
+
+	BeforeEach(func() {
+		histogram = metrics.NewHistogram("requestTime", nil)
+	})
+
+	It("reports count, sum, percentiles and max", func() {
+		for i := 1; i <= 1000; i++ {
+			histogram.Observe(time.Duration(i) * time.Millisecond)
+		}
+
+		snapshot := histogram.Flush()
+		Expect(snapshot.Count).To(Equal(uint64(1000)))
+		Expect(snapshot.Sum).To(Equal(500500 * time.Millisecond))
+		Expect(snapshot.Max).To(Equal(1000 * time.Millisecond))
+		Expect(snapshot.P50).To(BeNumerically("~", 500*time.Millisecond, 25*time.Millisecond))
+		Expect(snapshot.P95).To(BeNumerically("~", 950*time.Millisecond, 48*time.Millisecond))
+		Expect(snapshot.P99).To(BeNumerically("~", 990*time.Millisecond, 50*time.Millisecond))
+		Expect(snapshot.P99).To(BeNumerically("<=", snapshot.Max))
+	})
+
+	It("starts over after each flush", func() {
+		histogram.Observe(time.Second)
+		histogram.Flush()
+
+		Expect(histogram.Flush()).To(Equal(metrics.HistogramSnapshot{}))
+	})
+
+	It("never reports a percentile above the max", func() {
+		histogram.Observe(0)
+		histogram.Observe(100 * time.Nanosecond)
+
+		snapshot := histogram.Flush()
+		Expect(snapshot.P50).To(Equal(100 * time.Nanosecond))
+		Expect(snapshot.Max).To(Equal(100 * time.Nanosecond))
+	})
+
+	Context("when added to a MetricsEmitter", func() {
+		var (
+			sink    *metrics.InMemorySink
+			emitter *metrics.MetricsEmitter
+		)
+
+		BeforeEach(func() {
+			sink = metrics.NewInMemorySink()
+			emitter = metrics.NewMetricsEmitterWithSink(lagertest.NewTestLogger("test"), time.Hour, sink)
+			emitter.AddHistograms(histogram)
+		})
+
+		gauge := func(name string) metrics.Gauge {
+			gauge, ok := sink.Gauge(name)
+			Expect(ok).To(BeTrue(), name)
+			return gauge
+		}
+
+		emit := func() {
+			process := ifrit.Invoke(emitter)
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+		}
+
+		It("emits the aggregates in ms each interval", func() {
+			histogram.Observe(10 * time.Millisecond)
+			histogram.Observe(30 * time.Millisecond)
+			emit()
+
+			Expect(gauge("requestTime.count")).To(Equal(metrics.Gauge{Value: 2, Unit: "count"}))
+			Expect(gauge("requestTime.sum")).To(Equal(metrics.Gauge{Value: 40, Unit: "ms"}))
+			Expect(gauge("requestTime.max")).To(Equal(metrics.Gauge{Value: 30, Unit: "ms"}))
+			Expect(gauge("requestTime.p50").Value).To(BeNumerically("~", 10, 0.5))
+			Expect(gauge("requestTime.p95").Value).To(BeNumerically("~", 30, 1.5))
+			Expect(gauge("requestTime.p99").Unit).To(Equal("ms"))
+		})
+
+		It("only emits count and sum for an interval without observations", func() {
+			emit()
+
+			Expect(gauge("requestTime.count")).To(Equal(metrics.Gauge{Value: 0, Unit: "count"}))
+			_, ok := sink.Gauge("requestTime.p50")
+			Expect(ok).To(BeFalse())
+		})
+	})
+})
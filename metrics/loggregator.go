@@ -0,0 +1,256 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/mutualtls"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/lager"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	DefaultLoggregatorBatchSize     = 100
+	DefaultLoggregatorBufferSize    = 10000
+	DefaultLoggregatorFlushInterval = time.Second
+	DefaultLoggregatorSendTimeout   = 5 * time.Second
+)
+
+type LoggregatorConfig struct {
+	Address    string
+	ServerName string
+	CACertFile string
+	CertFile   string
+	KeyFile    string
+
+	SourceID   string
+	InstanceID string
+	Tags       map[string]string
+
+	BatchSize     int
+	BufferSize    int
+	FlushInterval time.Duration
+	SendTimeout   time.Duration
+}
+
+func (c LoggregatorConfig) WithDefaults() LoggregatorConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultLoggregatorBatchSize
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = DefaultLoggregatorBufferSize
+	}
+	if c.BufferSize < c.BatchSize {
+		c.BufferSize = c.BatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultLoggregatorFlushInterval
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = DefaultLoggregatorSendTimeout
+	}
+	return c
+}
+
+// LoggregatorSink sends metrics to a Loggregator v2 ingress server (usually
+// the local forwarder agent) over gRPC with mutual TLS. Envelopes are queued
+// and sent in batches by Run. Batches that fail to send stay queued until
+// the connection recovers; once BufferSize envelopes are queued the oldest
+// are dropped.
+type LoggregatorSink struct {
+	config LoggregatorConfig
+	logger lager.Logger
+	conn   *grpc.ClientConn
+	client loggregator_v2.IngressClient
+
+	flushLock  sync.Mutex
+	lock       sync.Mutex
+	pending    []*loggregator_v2.Envelope
+	dropped    uint64
+	batchReady chan struct{}
+}
+
+func NewLoggregatorSink(config LoggregatorConfig, logger lager.Logger) (*LoggregatorSink, error) {
+	config = config.WithDefaults()
+
+	tlsConfig, err := mutualtls.NewClientTLSConfig(config.CertFile, config.KeyFile, config.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("loggregator tls config: %s", err)
+	}
+	tlsConfig.ServerName = config.ServerName
+
+	conn, err := grpc.Dial(config.Address, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	if err != nil {
+		return nil, fmt.Errorf("loggregator dial: %s", err)
+	}
+
+	return &LoggregatorSink{
+		config:     config,
+		logger:     logger,
+		conn:       conn,
+		client:     loggregator_v2.NewIngressClient(conn),
+		batchReady: make(chan struct{}, 1),
+	}, nil
+}
+
+func (s *LoggregatorSink) SendGauge(name string, value float64, unit string) error {
+	return s.SendGaugeWithTags(name, value, unit, nil)
+}
+
+func (s *LoggregatorSink) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	return s.SendGauges(map[string]Gauge{name: {Value: value, Unit: unit}}, tags)
+}
+
+// SendGauges sends several values in a single gauge envelope.
+func (s *LoggregatorSink) SendGauges(gauges map[string]Gauge, tags map[string]string) error {
+	metrics := make(map[string]*loggregator_v2.GaugeValue, len(gauges))
+	for name, gauge := range gauges {
+		metrics[name] = &loggregator_v2.GaugeValue{Value: gauge.Value, Unit: gauge.Unit}
+	}
+
+	envelope := s.envelope(tags)
+	envelope.Message = &loggregator_v2.Envelope_Gauge{
+		Gauge: &loggregator_v2.Gauge{Metrics: metrics},
+	}
+	s.enqueue(envelope)
+	return nil
+}
+
+func (s *LoggregatorSink) AddToCounter(name string, delta uint64) error {
+	return s.AddToCounterWithTags(name, delta, nil)
+}
+
+func (s *LoggregatorSink) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	envelope := s.envelope(tags)
+	envelope.Message = &loggregator_v2.Envelope_Counter{
+		Counter: &loggregator_v2.Counter{Name: name, Delta: delta},
+	}
+	s.enqueue(envelope)
+	return nil
+}
+
+func (s *LoggregatorSink) SendDuration(name string, duration time.Duration) error {
+	return s.SendDurationWithTags(name, duration, nil)
+}
+
+func (s *LoggregatorSink) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	stop := time.Now()
+	return s.SendTimer(name, stop.Add(-duration), stop, tags)
+}
+
+func (s *LoggregatorSink) SendTimer(name string, start, stop time.Time, tags map[string]string) error {
+	envelope := s.envelope(tags)
+	envelope.Message = &loggregator_v2.Envelope_Timer{
+		Timer: &loggregator_v2.Timer{Name: name, Start: start.UnixNano(), Stop: stop.UnixNano()},
+	}
+	s.enqueue(envelope)
+	return nil
+}
+
+// Dropped returns how many envelopes were discarded because the buffer was
+// full.
+func (s *LoggregatorSink) Dropped() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.dropped
+}
+
+func (s *LoggregatorSink) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("loggregator-final-flush", err)
+			}
+			return s.conn.Close()
+		case <-ticker.C:
+		case <-s.batchReady:
+		}
+
+		if err := s.Flush(); err != nil {
+			s.logger.Error("loggregator-send", err)
+		}
+	}
+}
+
+// Flush sends everything queued. On failure the unsent envelopes stay
+// queued for the next attempt.
+func (s *LoggregatorSink) Flush() error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	for {
+		batch := s.nextBatch()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), s.config.SendTimeout)
+		_, err := s.client.Send(ctx, &loggregator_v2.EnvelopeBatch{Batch: batch})
+		cancel()
+		if err != nil {
+			s.requeue(batch)
+			return err
+		}
+	}
+}
+
+func (s *LoggregatorSink) envelope(tags map[string]string) *loggregator_v2.Envelope {
+	return &loggregator_v2.Envelope{
+		Timestamp:  time.Now().UnixNano(),
+		SourceId:   s.config.SourceID,
+		InstanceId: s.config.InstanceID,
+		Tags:       MergeTags(s.config.Tags, tags),
+	}
+}
+
+func (s *LoggregatorSink) enqueue(envelope *loggregator_v2.Envelope) {
+	s.lock.Lock()
+	s.pending = append(s.pending, envelope)
+	s.trimLocked()
+	batchReady := len(s.pending) >= s.config.BatchSize
+	s.lock.Unlock()
+
+	if batchReady {
+		select {
+		case s.batchReady <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *LoggregatorSink) nextBatch() []*loggregator_v2.Envelope {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	n := len(s.pending)
+	if n > s.config.BatchSize {
+		n = s.config.BatchSize
+	}
+	batch := s.pending[:n:n]
+	s.pending = s.pending[n:]
+	return batch
+}
+
+func (s *LoggregatorSink) requeue(batch []*loggregator_v2.Envelope) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pending = append(batch, s.pending...)
+	s.trimLocked()
+}
+
+func (s *LoggregatorSink) trimLocked() {
+	if excess := len(s.pending) - s.config.BufferSize; excess > 0 {
+		s.pending = s.pending[excess:]
+		s.dropped += uint64(excess)
+	}
+}
@@ -0,0 +1,181 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+	testmetrics "code.cloudfoundry.org/cf-networking-helpers/testsupport/metrics"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("LoggregatorSink", func() {
+	var (
+		certDir string
+		ingress *testmetrics.FakeLoggregatorIngress
+		config  metrics.LoggregatorConfig
+		sink    *metrics.LoggregatorSink
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "loggregator-certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		certWriter, err := testsupport.NewCertWriter(certDir)
+		Expect(err).NotTo(HaveOccurred())
+		caCertPath, err := certWriter.WriteCA("loggregator-ca")
+		Expect(err).NotTo(HaveOccurred())
+		serverCertPath, serverKeyPath, err := certWriter.WriteAndSign("metron", "loggregator-ca")
+		Expect(err).NotTo(HaveOccurred())
+		clientCertPath, clientKeyPath, err := certWriter.WriteAndSign("client", "loggregator-ca")
+		Expect(err).NotTo(HaveOccurred())
+
+		ingress, err = testmetrics.NewFakeLoggregatorIngress(serverCertPath, serverKeyPath, caCertPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		config = metrics.LoggregatorConfig{
+			Address:       ingress.Address(),
+			ServerName:    "metron",
+			CACertFile:    caCertPath,
+			CertFile:      clientCertPath,
+			KeyFile:       clientKeyPath,
+			SourceID:      "some-source",
+			InstanceID:    "some-instance",
+			Tags:          map[string]string{"job": "some-job"},
+			FlushInterval: 50 * time.Millisecond,
+			SendTimeout:   time.Second,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sink, err = metrics.NewLoggregatorSink(config, lagertest.NewTestLogger("test"))
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(sink)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		ingress.Close()
+		os.RemoveAll(certDir)
+	})
+
+	It("sends gauges, counters and timers as v2 envelopes", func() {
+		Expect(sink.SendGauge("queueDepth", 7, "count")).To(Succeed())
+		Expect(sink.AddToCounterWithTags("requests", 3, map[string]string{"status": "200"})).To(Succeed())
+		Expect(sink.SendDuration("requestTime", 2*time.Millisecond)).To(Succeed())
+
+		Eventually(ingress.AllEvents).Should(ConsistOf(
+			testmetrics.Event{EventType: "Gauge", Name: "queueDepth", Origin: "some-source", Value: 7},
+			testmetrics.Event{EventType: "Counter", Name: "requests", Origin: "some-source", Value: 3},
+			testmetrics.Event{EventType: "Timer", Name: "requestTime", Origin: "some-source", Value: float64(2 * time.Millisecond)},
+		))
+
+		envelopes := ingress.AllEnvelopes()
+		for _, envelope := range envelopes {
+			Expect(envelope.GetInstanceId()).To(Equal("some-instance"))
+			Expect(envelope.GetTags()).To(HaveKeyWithValue("job", "some-job"))
+		}
+		Expect(envelopes[1].GetTags()).To(HaveKeyWithValue("status", "200"))
+	})
+
+	It("sends several gauge values in one envelope", func() {
+		Expect(sink.SendGauges(map[string]metrics.Gauge{
+			"memory": {Value: 1024, Unit: "bytes"},
+			"cpu":    {Value: 12.5, Unit: "percentage"},
+		}, nil)).To(Succeed())
+
+		Eventually(ingress.AllEnvelopes).Should(HaveLen(1))
+		gauge := ingress.AllEnvelopes()[0].GetGauge()
+		Expect(gauge.GetMetrics()).To(HaveLen(2))
+		Expect(gauge.GetMetrics()["memory"].GetUnit()).To(Equal("bytes"))
+		Expect(gauge.GetMetrics()["cpu"].GetValue()).To(Equal(12.5))
+	})
+
+	Context("when a batch fills up", func() {
+		BeforeEach(func() {
+			config.BatchSize = 2
+			config.FlushInterval = time.Hour
+		})
+
+		It("sends it without waiting for the flush interval", func() {
+			Expect(sink.AddToCounter("a", 1)).To(Succeed())
+			Consistently(ingress.AllEnvelopes, 200*time.Millisecond).Should(BeEmpty())
+
+			Expect(sink.AddToCounter("b", 1)).To(Succeed())
+			Eventually(ingress.AllEnvelopes).Should(HaveLen(2))
+		})
+	})
+
+	Context("when the ingress server is unavailable", func() {
+		It("buffers envelopes and sends them once it recovers", func() {
+			ingress.SetFailing(true)
+			Expect(sink.AddToCounter("a", 1)).To(Succeed())
+			Expect(sink.Flush()).NotTo(Succeed())
+
+			ingress.Stop()
+			Expect(sink.AddToCounter("b", 1)).To(Succeed())
+			ingress.SetFailing(false)
+			Expect(ingress.Start()).To(Succeed())
+
+			Eventually(ingress.AllEvents, 5*time.Second).Should(ConsistOf(
+				testmetrics.Event{EventType: "Counter", Name: "a", Origin: "some-source", Value: 1},
+				testmetrics.Event{EventType: "Counter", Name: "b", Origin: "some-source", Value: 1},
+			))
+		})
+
+		Context("and the buffer is full", func() {
+			BeforeEach(func() {
+				config.BatchSize = 2
+				config.BufferSize = 2
+				config.FlushInterval = time.Hour
+			})
+
+			It("drops the oldest envelopes", func() {
+				ingress.SetFailing(true)
+				for _, name := range []string{"a", "b", "c"} {
+					Expect(sink.AddToCounter(name, 1)).To(Succeed())
+				}
+				Expect(sink.Flush()).NotTo(Succeed())
+				Expect(sink.Dropped()).To(Equal(uint64(1)))
+
+				ingress.SetFailing(false)
+				Expect(sink.Flush()).To(Succeed())
+				counterNames := func() []string {
+					names := []string{}
+					for _, envelope := range ingress.AllEnvelopes() {
+						names = append(names, envelope.GetCounter().GetName())
+					}
+					return names
+				}
+				Eventually(counterNames).Should(Equal([]string{"b", "c"}))
+			})
+		})
+	})
+
+	Context("when signalled", func() {
+		BeforeEach(func() {
+			config.FlushInterval = time.Hour
+		})
+
+		It("flushes what is left", func() {
+			Expect(sink.AddToCounter("last", 1)).To(Succeed())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(ingress.AllEnvelopes()).To(ConsistOf(
+				WithTransform(func(e *loggregator_v2.Envelope) string { return e.GetCounter().GetName() }, Equal("last")),
+			))
+		})
+	})
+})
@@ -1,60 +1,484 @@
 package metrics
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
+	"code.cloudfoundry.org/clock"
 	"code.cloudfoundry.org/lager"
+)
+
+const (
+	GetterErrorsMetric   = "metricsEmitterGetterErrors"
+	GetterTimeoutsMetric = "metricsEmitterGetterTimeouts"
 
-	dropsondemetrics "github.com/cloudfoundry/dropsonde/metrics"
+	// DefaultGetterTimeout bounds getters without a Timeout of their own
+	// where there is no emit interval to bound them, as in PrometheusHandler
+	// and SnapshotWriter.
+	DefaultGetterTimeout = 5 * time.Second
+
+	// FinalFlushTimeout bounds the emit on exit with SetFlushOnExit. Getters
+	// get half of it, so that the values that did arrive are still sent.
+	FinalFlushTimeout = 2 * time.Second
 )
 
 type MetricSource struct {
 	Name   string
 	Unit   string
+	Tags   map[string]string
 	Getter func() (float64, error)
+	// Timeout bounds how long the emitter waits for Getter. It defaults to
+	// the emitter's getter timeout, if set, or else the emit interval.
+	Timeout time.Duration
 }
 
+// MetricsEmitter calls all getters concurrently each interval, off the
+// goroutine that handles signals. An interval that is up while the previous
+// emit still waits for getters starts as soon as that emit is done. A getter
+// that times out is not called again until its previous call returns.
+// Getter errors and timeouts are counted as GetterErrorsMetric and
+// GetterTimeoutsMetric, tagged with the source name and the source's tags.
+// Sources can be registered and unregistered while the emitter runs, and are
+// identified by their name and tags. Registered names must be unique, as
+// sinks without tag support such as dropsonde cannot tell apart sources that
+// differ in their tags only, unless SetAllowSharedNames is used.
 type MetricsEmitter struct {
 	logger   lager.Logger
 	interval time.Duration
-	metrics  []MetricSource
+	sink     Sink
+
+	lock             sync.Mutex
+	clock            clock.Clock
+	sources          []*registeredSource
+	histograms       []*Histogram
+	stats            EmitterStats
+	errorLog         errorLog
+	errorLogInterval time.Duration
+	getterTimeout    time.Duration
+	flushOnExit      bool
+	allowSharedNames bool
+}
+
+// EmitterStats counts what went wrong while emitting. EmitDuration is how
+// long the last round of getters and sends took.
+type EmitterStats struct {
+	GetterErrors   uint64
+	GetterTimeouts uint64
+	SendErrors     uint64
+	EmitDuration   time.Duration
+}
+
+func (s MetricSource) key() string {
+	return FlattenTags(s.Name, s.Tags)
+}
+
+type registeredSource struct {
+	MetricSource
+	busy    bool
+	removed bool
+}
+
+type getterResult struct {
+	value    float64
+	err      error
+	timedOut bool
 }
 
 func NewMetricsEmitter(logger lager.Logger, interval time.Duration, metrics ...MetricSource) *MetricsEmitter {
+	return NewMetricsEmitterWithSink(logger, interval, DropsondeSink{}, metrics...)
+}
+
+func NewMetricsEmitterWithSink(logger lager.Logger, interval time.Duration, sink Sink, metrics ...MetricSource) *MetricsEmitter {
+	sources := make([]*registeredSource, 0, len(metrics))
+	for _, source := range metrics {
+		sources = append(sources, &registeredSource{MetricSource: source})
+	}
+
 	return &MetricsEmitter{
 		logger:   logger,
 		interval: interval,
-		metrics:  metrics,
+		sink:     sink,
+		clock:    clock.NewClock(),
+		sources:  sources,
+	}
+}
+
+// Register adds a source that is emitted from the next interval on. Its
+// name must not be registered yet, or with SetAllowSharedNames, not with the
+// same tags.
+func (m *MetricsEmitter) Register(source MetricSource) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	key := source.key()
+	for _, registered := range m.sources {
+		if registered.key() == key {
+			return fmt.Errorf("metric source %q is already registered", key)
+		}
+		if !m.allowSharedNames && registered.Name == source.Name {
+			return fmt.Errorf("metric source %q is already registered", source.Name)
+		}
+	}
+	m.sources = append(m.sources, &registeredSource{MetricSource: source})
+	return nil
+}
+
+// Unregister removes the source with the given name and tags. With emitFinal
+// its getter is called one last time and the value sent before Unregister
+// returns.
+func (m *MetricsEmitter) Unregister(name string, tags map[string]string, emitFinal bool) error {
+	key := FlattenTags(name, tags)
+
+	m.lock.Lock()
+	var removed *registeredSource
+	sources := make([]*registeredSource, 0, len(m.sources))
+	for _, registered := range m.sources {
+		if registered.key() == key && removed == nil {
+			removed = registered
+			continue
+		}
+		sources = append(sources, registered)
 	}
+	if removed == nil {
+		m.lock.Unlock()
+		return fmt.Errorf("metric source %q is not registered", key)
+	}
+	m.sources = sources
+	m.lock.Unlock()
+
+	if emitFinal {
+		m.emit([]*registeredSource{removed}, 0)
+	}
+
+	m.lock.Lock()
+	removed.removed = true
+	m.lock.Unlock()
+	return nil
+}
+
+// SetAllowSharedNames lets Register add sources whose name is registered
+// already, as long as their tags differ, e.g. NewCertExpirySources. Use it
+// with sinks that keep tags apart, such as TaggedSinks or those that get the
+// tags flattened into the name.
+func (m *MetricsEmitter) SetAllowSharedNames(allowed bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.allowSharedNames = allowed
+}
+
+// SetErrorLogInterval limits how often recurring getter and send errors are
+// logged. It defaults to DefaultErrorLogInterval.
+func (m *MetricsEmitter) SetErrorLogInterval(interval time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.errorLogInterval = interval
+}
+
+// SetGetterTimeout bounds getters without a Timeout of their own more
+// tightly than the emit interval, e.g. DefaultGetterTimeout. Zero, the
+// default, leaves them bounded by the interval only.
+func (m *MetricsEmitter) SetGetterTimeout(timeout time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.getterTimeout = timeout
+}
+
+// SetFlushOnExit makes Run emit once more when signalled, for jobs that may
+// exit before the first interval is up. The emit is bounded by
+// FinalFlushTimeout. Ordered groups stop their members in reverse order, so
+// list the emitter after sinks that buffer, such as StatsdSink, for it to
+// flush before they send what they hold.
+func (m *MetricsEmitter) SetFlushOnExit(enabled bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.flushOnExit = enabled
+}
+
+// SetClock replaces the clock that drives the emit interval and getter
+// timeouts. It must be called before Run.
+func (m *MetricsEmitter) SetClock(clock clock.Clock) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clock = clock
+}
+
+func (m *MetricsEmitter) getClock() clock.Clock {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.clock
+}
+
+func (m *MetricsEmitter) Stats() EmitterStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.stats
+}
+
+// AddHistograms has each histogram flushed every interval as
+// <name>.count, <name>.sum, <name>.p50, <name>.p95, <name>.p99 and <name>.max.
+// Durations are sent in ms; only count and sum are sent for an interval
+// without observations.
+func (m *MetricsEmitter) AddHistograms(histograms ...*Histogram) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.histograms = append(m.histograms, histograms...)
 }
 
 func (m *MetricsEmitter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
-	m.emitMetrics()
-	close(ready)
+	ticker := m.getClock().NewTicker(m.interval)
+	defer ticker.Stop()
 
+	emitting := m.startEmit()
+	pending := false
 	for {
 		select {
 		case <-signals:
+			m.lock.Lock()
+			flushOnExit := m.flushOnExit
+			m.lock.Unlock()
+			if flushOnExit {
+				m.finalFlush()
+			}
 			return nil
-		case <-time.After(m.interval):
-			m.emitMetrics()
+		case <-ticker.C():
+			if emitting != nil {
+				pending = true
+				continue
+			}
+			emitting = m.startEmit()
+		case <-emitting:
+			emitting = nil
+			if ready != nil {
+				close(ready)
+				ready = nil
+			}
+			if pending {
+				pending = false
+				emitting = m.startEmit()
+			}
 		}
 	}
 }
 
-func (m *MetricsEmitter) emitMetrics() {
-	for _, source := range m.metrics {
-		value, err := source.Getter()
-		if err != nil {
-			m.logger.Error("metric-getter", err, lager.Data{"source": source.Name})
+func (m *MetricsEmitter) startEmit() <-chan struct{} {
+	done := make(chan struct{})
+	go func() {
+		m.emitMetrics(0)
+		close(done)
+	}()
+	return done
+}
+
+func (m *MetricsEmitter) finalFlush() {
+	done := make(chan struct{})
+	go func() {
+		m.emitMetrics(FinalFlushTimeout / 2)
+		close(done)
+	}()
+
+	timer := m.getClock().NewTimer(FinalFlushTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C():
+		m.logger.Error("final-flush-timeout", fmt.Errorf("timed out after %s", FinalFlushTimeout))
+	}
+}
+
+// emitMetrics shortens getter timeouts to maxTimeout, unless it is 0.
+func (m *MetricsEmitter) emitMetrics(maxTimeout time.Duration) {
+	m.lock.Lock()
+	clock := m.clock
+	sources := m.sources
+	histograms := m.histograms
+	m.lock.Unlock()
+
+	start := clock.Now()
+	m.emit(sources, maxTimeout)
+
+	for _, histogram := range histograms {
+		m.emitHistogram(histogram)
+	}
+
+	m.lock.Lock()
+	m.stats.EmitDuration = clock.Since(start)
+	m.lock.Unlock()
+}
+
+func (m *MetricsEmitter) emit(sources []*registeredSource, maxTimeout time.Duration) {
+	results := make([]getterResult, len(sources))
+	wg := sync.WaitGroup{}
+	for i, source := range sources {
+		wg.Add(1)
+		go func(i int, source *registeredSource) {
+			defer wg.Done()
+			results[i] = m.get(source, maxTimeout)
+		}(i, source)
+	}
+	wg.Wait()
+
+	for i, source := range sources {
+		m.lock.Lock()
+		removed := source.removed
+		m.lock.Unlock()
+		if removed {
 			continue
 		}
 
-		dropsondemetrics.SendValue(source.Name, value, source.Unit)
+		result := results[i]
+		key := source.key()
+		switch {
+		case result.timedOut:
+			m.logError("metric-getter-timeout:"+key, "metric-getter-timeout", key, result.err)
+			m.countFailure(GetterTimeoutsMetric, source.MetricSource)
+		case result.err != nil:
+			m.logError("metric-getter:"+key, "metric-getter", key, result.err)
+			m.countFailure(GetterErrorsMetric, source.MetricSource)
+		default:
+			m.send(source.Name, result.value, source.Unit, source.Tags)
+		}
+	}
+}
+
+func (m *MetricsEmitter) get(source *registeredSource, maxTimeout time.Duration) getterResult {
+	m.lock.Lock()
+	if source.busy {
+		m.lock.Unlock()
+		return getterResult{timedOut: true, err: errors.New("previous call has not returned")}
+	}
+	source.busy = true
+	m.lock.Unlock()
+
+	m.lock.Lock()
+	timeout := source.Timeout
+	if timeout <= 0 {
+		timeout = m.getterTimeout
 	}
+	m.lock.Unlock()
+	if timeout <= 0 {
+		timeout = m.interval
+	}
+	if maxTimeout > 0 && timeout > maxTimeout {
+		timeout = maxTimeout
+	}
+
+	return callGetter(m.getClock(), source.Getter, timeout, func() {
+		m.lock.Lock()
+		source.busy = false
+		m.lock.Unlock()
+	})
+}
+
+// callGetter waits up to timeout for getter, or until it returns if timeout
+// is zero. returned, if set, is called when getter returns, even if
+// callGetter has given up on it by then.
+func callGetter(clk clock.Clock, getter func() (float64, error), timeout time.Duration, returned func()) getterResult {
+	done := make(chan getterResult, 1)
+	go func() {
+		value, err := getter()
+		if returned != nil {
+			returned()
+		}
+		done <- getterResult{value: value, err: err}
+	}()
+
+	if timeout <= 0 {
+		return <-done
+	}
+	timer := clk.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result
+	case <-timer.C():
+		return getterResult{timedOut: true, err: fmt.Errorf("timed out after %s", timeout)}
+	}
+}
+
+// getValues calls the getters of sources concurrently, waiting for each up
+// to its own Timeout or else defaultTimeout.
+func getValues(clk clock.Clock, sources []MetricSource, defaultTimeout time.Duration) []getterResult {
+	results := make([]getterResult, len(sources))
+	wg := sync.WaitGroup{}
+	for i, source := range sources {
+		timeout := source.Timeout
+		if timeout <= 0 {
+			timeout = defaultTimeout
+		}
+
+		wg.Add(1)
+		go func(i int, getter func() (float64, error)) {
+			defer wg.Done()
+			results[i] = callGetter(clk, getter, timeout, nil)
+		}(i, source.Getter)
+	}
+	wg.Wait()
+	return results
+}
+
+func (m *MetricsEmitter) countFailure(name string, source MetricSource) {
+	m.lock.Lock()
+	if name == GetterTimeoutsMetric {
+		m.stats.GetterTimeouts++
+	} else {
+		m.stats.GetterErrors++
+	}
+	m.lock.Unlock()
+
+	err := addToCounter(m.sink, name, 1, MergeTags(source.Tags, map[string]string{"source": source.Name}))
+	if err != nil {
+		m.sendFailed(name, err)
+	}
+}
+
+func (m *MetricsEmitter) emitHistogram(histogram *Histogram) {
+	snapshot := histogram.Flush()
+	name, tags := histogram.name, histogram.tags
+
+	m.send(name+".count", float64(snapshot.Count), "count", tags)
+	m.send(name+".sum", durationMillis(snapshot.Sum), "ms", tags)
+	if snapshot.Count == 0 {
+		return
+	}
+	m.send(name+".p50", durationMillis(snapshot.P50), "ms", tags)
+	m.send(name+".p95", durationMillis(snapshot.P95), "ms", tags)
+	m.send(name+".p99", durationMillis(snapshot.P99), "ms", tags)
+	m.send(name+".max", durationMillis(snapshot.Max), "ms", tags)
+}
+
+func (m *MetricsEmitter) send(name string, value float64, unit string, tags map[string]string) {
+	err := sendGauge(m.sink, name, value, unit, tags)
+	if err != nil {
+		m.sendFailed(name, err)
+	}
+}
+
+func (m *MetricsEmitter) sendFailed(name string, err error) {
+	m.lock.Lock()
+	m.stats.SendErrors++
+	m.lock.Unlock()
+	m.logError("sending-metric", "sending-metric", name, err)
+}
+
+// logError rate-limits errors by key; getter errors are keyed per source,
+// send errors are not, as they usually fail alike for every metric.
+func (m *MetricsEmitter) logError(key, action, source string, err error) {
+	m.lock.Lock()
+	interval := m.errorLogInterval
+	m.lock.Unlock()
+
+	m.errorLog.Error(m.logger, interval, key, action, err, lager.Data{"source": source})
+}
+
+func durationMillis(duration time.Duration) float64 {
+	return duration.Seconds() * 1000
 }
 
 func (m *MetricsEmitter) EmitMetrics() {
-	m.emitMetrics()
+	m.emitMetrics(0)
 }
@@ -1,11 +1,16 @@
 package metrics_test
 
 import (
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"time"
 
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
 	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/clock/fakeclock"
 	"code.cloudfoundry.org/lager/lagertest"
 
 	"github.com/cloudfoundry/sonde-go/events"
@@ -14,6 +19,7 @@ import (
 	. "github.com/onsi/gomega"
 	"github.com/onsi/gomega/gbytes"
 	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
 )
 
 const (
@@ -50,6 +56,26 @@ var _ = Describe("MetricsEmitter", func() {
 		}
 	})
 
+	valueMetricNames := func() []string {
+		names := []string{}
+		for _, message := range fakeDropsonde.GetMessages() {
+			if metric, ok := message.Event.(*events.ValueMetric); ok {
+				names = append(names, metric.GetName())
+			}
+		}
+		return names
+	}
+
+	counterNames := func() []string {
+		names := []string{}
+		for _, message := range fakeDropsonde.GetMessages() {
+			if counter, ok := message.Event.(*events.CounterEvent); ok {
+				names = append(names, counter.GetName())
+			}
+		}
+		return names
+	}
+
 	AfterEach(func() {
 		metricsEmitterProc.Signal(os.Interrupt)
 		Eventually(metricsEmitterProc.Wait()).Should(Receive())
@@ -88,6 +114,222 @@ var _ = Describe("MetricsEmitter", func() {
 		Expect(*metric.Value).To(Equal(42.0))
 	})
 
+	Context("with a fake clock", func() {
+		var clock *fakeclock.FakeClock
+
+		BeforeEach(func() {
+			clock = fakeclock.NewFakeClock(time.Now())
+			metricsEmitter = metrics.NewMetricsEmitter(logger, time.Minute, fakeSource)
+			metricsEmitter.SetClock(clock)
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+		})
+
+		It("emits once per interval", func() {
+			Expect(valueMetricNames()).To(HaveLen(1))
+
+			clock.Increment(time.Minute - time.Second)
+			Consistently(valueMetricNames).Should(HaveLen(1))
+
+			clock.Increment(time.Second)
+			Eventually(valueMetricNames).Should(HaveLen(2))
+
+			clock.Increment(time.Minute)
+			Eventually(valueMetricNames).Should(HaveLen(3))
+		})
+
+		It("times getters out on the clock", func() {
+			release := make(chan struct{})
+			defer close(release)
+			Expect(metricsEmitter.Register(metrics.MetricSource{
+				Name:    "slowSource",
+				Timeout: 5 * time.Second,
+				Getter: func() (float64, error) {
+					<-release
+					return 1, nil
+				},
+			})).To(Succeed())
+
+			clock.Increment(time.Minute)
+			Eventually(clock.WatcherCount).Should(Equal(2))
+			Consistently(counterNames).Should(BeEmpty())
+
+			clock.Increment(5 * time.Second)
+			Eventually(counterNames).Should(Equal([]string{metrics.GetterTimeoutsMetric + ";source=slowSource"}))
+			Expect(valueMetricNames()).To(Equal([]string{"fakeSource", "fakeSource"}))
+		})
+
+		Context("when a getter without a timeout is stuck", func() {
+			var release chan struct{}
+
+			BeforeEach(func() {
+				release = make(chan struct{})
+				released := release
+				Expect(metricsEmitter.Register(metrics.MetricSource{
+					Name: "slowSource",
+					Getter: func() (float64, error) {
+						<-released
+						return 1, nil
+					},
+				})).To(Succeed())
+
+				clock.Increment(time.Minute)
+				Eventually(clock.WatcherCount).Should(Equal(2))
+			})
+
+			AfterEach(func() {
+				close(release)
+			})
+
+			It("times it out when the interval is up", func() {
+				clock.Increment(time.Minute - time.Millisecond)
+				Consistently(counterNames).Should(BeEmpty())
+
+				clock.Increment(time.Millisecond)
+				Eventually(counterNames).Should(ContainElement(metrics.GetterTimeoutsMetric + ";source=slowSource"))
+			})
+
+			It("handles signals in the meantime", func() {
+				metricsEmitterProc.Signal(os.Interrupt)
+				Eventually(metricsEmitterProc.Wait()).Should(Receive())
+			})
+		})
+
+		It("times getters without a timeout out after the getter timeout, if set", func() {
+			release := make(chan struct{})
+			defer close(release)
+			metricsEmitter.SetGetterTimeout(10 * time.Second)
+			Expect(metricsEmitter.Register(metrics.MetricSource{
+				Name: "slowSource",
+				Getter: func() (float64, error) {
+					<-release
+					return 1, nil
+				},
+			})).To(Succeed())
+
+			clock.Increment(time.Minute)
+			Eventually(clock.WatcherCount).Should(Equal(2))
+			clock.Increment(10*time.Second - time.Millisecond)
+			Consistently(counterNames).Should(BeEmpty())
+
+			clock.Increment(time.Millisecond)
+			Eventually(counterNames).Should(Equal([]string{metrics.GetterTimeoutsMetric + ";source=slowSource"}))
+		})
+	})
+
+	It("does not emit when signalled by default", func() {
+		metricsEmitter = metrics.NewMetricsEmitter(logger, time.Hour, fakeSource)
+		metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+		Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+
+		metricsEmitterProc.Signal(os.Interrupt)
+		Eventually(metricsEmitterProc.Wait()).Should(Receive())
+		Expect(valueMetricNames()).To(Equal([]string{"fakeSource"}))
+	})
+
+	Context("when flushing on exit", func() {
+		BeforeEach(func() {
+			metricsEmitter = metrics.NewMetricsEmitter(logger, time.Hour, fakeSource)
+			metricsEmitter.SetFlushOnExit(true)
+		})
+
+		It("emits once more before Run returns", func() {
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+
+			metricsEmitterProc.Signal(os.Interrupt)
+			Eventually(metricsEmitterProc.Wait()).Should(Receive())
+			Expect(valueMetricNames()).To(Equal([]string{"fakeSource", "fakeSource"}))
+		})
+
+		It("reaches the sinks listed before it in an ordered group", func() {
+			dir, err := ioutil.TempDir("", "flush-on-exit")
+			Expect(err).NotTo(HaveOccurred())
+			defer os.RemoveAll(dir)
+
+			emits := 0.0
+			path := filepath.Join(dir, "metrics.json")
+			writer := metrics.NewSnapshotWriter(logger, metrics.SnapshotConfig{Path: path})
+			metricsEmitter = metrics.NewMetricsEmitterWithSink(logger, time.Hour, writer, metrics.MetricSource{
+				Name: "emits",
+				Getter: func() (float64, error) {
+					emits++
+					return emits, nil
+				},
+			})
+			metricsEmitter.SetFlushOnExit(true)
+
+			metricsEmitterProc = ifrit.Invoke(grouper.NewOrdered(os.Interrupt, grouper.Members{
+				{Name: "snapshot-writer", Runner: writer},
+				{Name: "metrics-emitter", Runner: metricsEmitter},
+			}))
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+			metricsEmitterProc.Signal(os.Interrupt)
+			Eventually(metricsEmitterProc.Wait()).Should(Receive(BeNil()))
+
+			contents, err := ioutil.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			var snapshot metrics.Snapshot
+			Expect(json.Unmarshal(contents, &snapshot)).To(Succeed())
+			Expect(snapshot.Gauges).To(HaveKeyWithValue("emits", metrics.Gauge{Value: 2}))
+		})
+
+		Context("with a fake clock", func() {
+			var clock *fakeclock.FakeClock
+
+			BeforeEach(func() {
+				clock = fakeclock.NewFakeClock(time.Now())
+			})
+
+			It("times stuck getters out early and still exits", func() {
+				release := make(chan struct{})
+				defer close(release)
+
+				metricsEmitter = metrics.NewMetricsEmitter(logger, time.Hour)
+				metricsEmitter.SetFlushOnExit(true)
+				metricsEmitter.SetClock(clock)
+				metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+				Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+				Expect(metricsEmitter.Register(metrics.MetricSource{
+					Name: "stuckSource",
+					Getter: func() (float64, error) {
+						<-release
+						return 1, nil
+					},
+				})).To(Succeed())
+
+				metricsEmitterProc.Signal(os.Interrupt)
+				Eventually(clock.WatcherCount).Should(Equal(3))
+				clock.Increment(metrics.FinalFlushTimeout / 2)
+				Eventually(metricsEmitterProc.Wait()).Should(Receive())
+				Expect(counterNames()).To(Equal([]string{metrics.GetterTimeoutsMetric + ";source=stuckSource"}))
+			})
+
+			It("gives up on sends that do not return", func() {
+				release := make(chan struct{})
+				defer close(release)
+
+				sink := &fakes.MetricsSink{}
+				metricsEmitter = metrics.NewMetricsEmitterWithSink(logger, time.Hour, sink, fakeSource)
+				metricsEmitter.SetFlushOnExit(true)
+				metricsEmitter.SetClock(clock)
+				metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+				Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+				sink.SendGaugeCalls(func(string, float64, string) error {
+					<-release
+					return nil
+				})
+
+				metricsEmitterProc.Signal(os.Interrupt)
+				Eventually(sink.SendGaugeCallCount).Should(Equal(2))
+				Expect(clock.WatcherCount()).To(Equal(2))
+				clock.Increment(metrics.FinalFlushTimeout)
+				Eventually(metricsEmitterProc.Wait()).Should(Receive())
+				Expect(logger).To(gbytes.Say("final-flush-timeout"))
+			})
+		})
+	})
+
 	Context("when the metric source getter fails", func() {
 		BeforeEach(func() {
 			badSource := metrics.MetricSource{
@@ -105,7 +347,153 @@ var _ = Describe("MetricsEmitter", func() {
 
 		It("does not send a value", func() {
 			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
-			Consistently(fakeDropsonde.GetMessages, "1s").Should(BeEmpty())
+			Consistently(valueMetricNames, "1s").ShouldNot(ContainElement("badSource"))
+		})
+
+		It("counts the error", func() {
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(counterNames).Should(ContainElement("metricsEmitterGetterErrors;source=badSource"))
+			Eventually(func() uint64 { return metricsEmitter.Stats().GetterErrors }).Should(BeNumerically(">=", 2))
+			Expect(metricsEmitter.Stats().EmitDuration).To(BeNumerically(">", 0))
+		})
+
+		It("logs a recurring error once per error log interval", func() {
+			metricsEmitter.SetErrorLogInterval(time.Hour)
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(func() uint64 { return metricsEmitter.Stats().GetterErrors }).Should(BeNumerically(">=", 3))
+
+			getterErrorLogs := func() int {
+				count := 0
+				for _, message := range logger.LogMessages() {
+					if message == "test.metric-getter" {
+						count++
+					}
+				}
+				return count
+			}
+			Expect(getterErrorLogs()).To(Equal(1))
+		})
+	})
+
+	Context("when a metric source getter is slow", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			released := release
+			slowSource := metrics.MetricSource{
+				Name:    "slowSource",
+				Unit:    "fakeUnit",
+				Timeout: 10 * time.Millisecond,
+				Getter: func() (float64, error) {
+					<-released
+					return 1, nil
+				},
+			}
+			metricsEmitter = metrics.NewMetricsEmitter(logger, interval, slowSource, fakeSource)
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("still emits the other sources on time", func() {
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+			Expect(valueMetricNames()).To(Equal([]string{"fakeSource"}))
+			Eventually(valueMetricNames).Should(Equal([]string{"fakeSource", "fakeSource"}))
+		})
+
+		It("logs and counts the timeouts", func() {
+			metricsEmitter.SetErrorLogInterval(time.Millisecond)
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(logger).Should(gbytes.Say("metric-getter-timeout.*timed out after 10ms.*slowSource"))
+			Eventually(logger).Should(gbytes.Say("metric-getter-timeout.*previous call has not returned.*slowSource"))
+			Eventually(counterNames).Should(ContainElement("metricsEmitterGetterTimeouts;source=slowSource"))
+		})
+
+		It("handles signals while the getter is stuck", func() {
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+			metricsEmitterProc.Signal(os.Interrupt)
+			Eventually(metricsEmitterProc.Wait(), "100ms").Should(Receive())
+		})
+	})
+
+	Describe("Register", func() {
+		BeforeEach(func() {
+			metricsEmitter = metrics.NewMetricsEmitter(logger, interval, fakeSource)
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+		})
+
+		It("emits sources added while running", func() {
+			Expect(metricsEmitter.Register(fakeSource2)).To(Succeed())
+			Eventually(valueMetricNames).Should(ContainElement("fakeSource2"))
+		})
+
+		It("rejects duplicate names", func() {
+			Expect(metricsEmitter.Register(fakeSource)).To(MatchError(`metric source "fakeSource" is already registered`))
+		})
+
+		It("rejects duplicate names with other tags", func() {
+			fakeSource.Tags = map[string]string{"queue": "a"}
+			Expect(metricsEmitter.Register(fakeSource)).To(MatchError(`metric source "fakeSource" is already registered`))
+		})
+
+		Context("when sources may share names", func() {
+			BeforeEach(func() {
+				metricsEmitter.SetAllowSharedNames(true)
+			})
+
+			It("tells them apart by their tags", func() {
+				fakeSource.Tags = map[string]string{"queue": "a"}
+				Expect(metricsEmitter.Register(fakeSource)).To(Succeed())
+				Expect(metricsEmitter.Register(fakeSource)).To(MatchError(`metric source "fakeSource;queue=a" is already registered`))
+			})
+		})
+	})
+
+	Describe("Unregister", func() {
+		BeforeEach(func() {
+			fakeSource2.Getter = func() (float64, error) { return 0, nil }
+			metricsEmitter = metrics.NewMetricsEmitter(logger, time.Hour, fakeSource, fakeSource2)
+			metricsEmitterProc = ifrit.Invoke(metricsEmitter)
+			Eventually(metricsEmitterProc.Ready()).Should(BeClosed())
+			fakeDropsonde.Reset()
+		})
+
+		It("stops emitting the source", func() {
+			Expect(metricsEmitter.Unregister("fakeSource2", nil, false)).To(Succeed())
+			Expect(fakeDropsonde.GetMessages()).To(BeEmpty())
+
+			metricsEmitter.EmitMetrics()
+			Expect(valueMetricNames()).To(Equal([]string{"fakeSource"}))
+		})
+
+		It("can emit a final value", func() {
+			Expect(metricsEmitter.Unregister("fakeSource2", nil, true)).To(Succeed())
+			Expect(valueMetricNames()).To(Equal([]string{"fakeSource2"}))
+		})
+
+		It("allows the name to be registered again", func() {
+			Expect(metricsEmitter.Unregister("fakeSource2", nil, false)).To(Succeed())
+			Expect(metricsEmitter.Register(fakeSource2)).To(Succeed())
+		})
+
+		It("removes tagged sources by their name and tags", func() {
+			metricsEmitter.SetAllowSharedNames(true)
+			fakeSource2.Tags = map[string]string{"queue": "a"}
+			Expect(metricsEmitter.Register(fakeSource2)).To(Succeed())
+			Expect(metricsEmitter.Unregister("fakeSource2", map[string]string{"queue": "b"}, false)).To(MatchError(`metric source "fakeSource2;queue=b" is not registered`))
+			Expect(metricsEmitter.Unregister("fakeSource2", map[string]string{"queue": "a"}, false)).To(Succeed())
+
+			metricsEmitter.EmitMetrics()
+			Expect(valueMetricNames()).To(ConsistOf("fakeSource", "fakeSource2"))
+		})
+
+		It("fails for unknown sources", func() {
+			Expect(metricsEmitter.Unregister("potato", nil, false)).To(MatchError(`metric source "potato" is not registered`))
 		})
 	})
 })
@@ -1,31 +1,90 @@
 package metrics
 
 import (
+	"sync"
 	"time"
 
 	"code.cloudfoundry.org/lager"
-
-	dropsondemetrics "github.com/cloudfoundry/dropsonde/metrics"
 )
 
 type MetricsSender struct {
 	Logger lager.Logger
+	// Sink receives every metric sent. It defaults to DropsondeSink.
+	Sink Sink
+	// ErrorLogInterval limits how often send errors are logged. It defaults
+	// to DefaultErrorLogInterval.
+	ErrorLogInterval time.Duration
+
+	lock       sync.Mutex
+	sendErrors uint64
+	errorLog   errorLog
+}
+
+func NewMetricsSender(logger lager.Logger, sink Sink) *MetricsSender {
+	return &MetricsSender{
+		Logger: logger,
+		Sink:   sink,
+	}
+}
+
+func (ms *MetricsSender) sink() Sink {
+	if ms.Sink == nil {
+		return DropsondeSink{}
+	}
+	return ms.Sink
 }
 
 func (ms *MetricsSender) SendDuration(name string, duration time.Duration) {
-	ms.SendValue(name, duration.Seconds()*1000, "ms")
+	ms.SendDurationWithTags(name, duration, nil)
+}
+
+func (ms *MetricsSender) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) {
+	err := sendDuration(ms.sink(), name, duration, tags)
+	if err != nil {
+		ms.sendFailed(name, err)
+	}
 }
 
 func (ms *MetricsSender) SendValue(name string, value float64, units string) {
-	err := dropsondemetrics.SendValue(name, value, units)
+	ms.SendValueWithTags(name, value, units, nil)
+}
+
+func (ms *MetricsSender) SendValueWithTags(name string, value float64, units string, tags map[string]string) {
+	err := sendGauge(ms.sink(), name, value, units, tags)
 	if err != nil {
-		ms.Logger.Error("sending-metric", err)
+		ms.sendFailed(name, err)
 	}
 }
 
 func (ms *MetricsSender) IncrementCounter(name string) {
-	err := dropsondemetrics.IncrementCounter(name)
+	ms.IncrementCounterWithTags(name, nil)
+}
+
+func (ms *MetricsSender) IncrementCounterWithTags(name string, tags map[string]string) {
+	ms.AddToCounterWithTags(name, 1, tags)
+}
+
+func (ms *MetricsSender) AddToCounter(name string, delta uint64) {
+	ms.AddToCounterWithTags(name, delta, nil)
+}
+
+func (ms *MetricsSender) AddToCounterWithTags(name string, delta uint64, tags map[string]string) {
+	err := addToCounter(ms.sink(), name, delta, tags)
 	if err != nil {
-		ms.Logger.Error("sending-metric", err)
+		ms.sendFailed(name, err)
 	}
 }
+
+// SendErrors returns how many metrics the sink failed to send.
+func (ms *MetricsSender) SendErrors() uint64 {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	return ms.sendErrors
+}
+
+func (ms *MetricsSender) sendFailed(name string, err error) {
+	ms.lock.Lock()
+	ms.sendErrors++
+	ms.lock.Unlock()
+	ms.errorLog.Error(ms.Logger, ms.ErrorLogInterval, "sending-metric", "sending-metric", err, lager.Data{"metric": name})
+}
@@ -2,6 +2,7 @@ package metrics_test
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"code.cloudfoundry.org/cf-networking-helpers/metrics"
@@ -113,6 +114,30 @@ var _ = Describe("Metrics Sender", func() {
 				metricsSender.SendValue(name, value, units)
 				Expect(logger).To(gbytes.Say("sending-metric.*banana"))
 			})
+
+			It("counts the errors and logs them once per error log interval", func() {
+				metricsSender.ErrorLogInterval = 100 * time.Millisecond
+				for i := 0; i < 3; i++ {
+					fakeDropsonde.ReturnError = errors.New("banana")
+					metricsSender.SendValue(name, value, units)
+				}
+				Expect(metricsSender.SendErrors()).To(Equal(uint64(3)))
+				Expect(logger.LogMessages()).To(Equal([]string{"test.sending-metric"}))
+
+				time.Sleep(100 * time.Millisecond)
+				fakeDropsonde.ReturnError = errors.New("banana")
+				metricsSender.SendValue(name, value, units)
+				Expect(logger.LogMessages()).To(HaveLen(2))
+				Expect(logger.Logs()[1].Data).To(HaveKeyWithValue("suppressed", BeNumerically("==", 2)))
+			})
+
+			It("rate-limits errors of the same type whose messages vary", func() {
+				for i := 0; i < 3; i++ {
+					fakeDropsonde.ReturnError = fmt.Errorf("banana %d", i)
+					metricsSender.SendValue(name, value, units)
+				}
+				Expect(logger.LogMessages()).To(Equal([]string{"test.sending-metric"}))
+			})
 		})
 	})
 
@@ -141,4 +166,16 @@ var _ = Describe("Metrics Sender", func() {
 			})
 		})
 	})
+
+	Describe("AddToCounter", func() {
+		It("sends the delta through dropsonde", func() {
+			metricsSender.AddToCounter("foo", 5)
+			Eventually(getCounterEvents).Should(ConsistOf(
+				&events.CounterEvent{
+					Name:  proto.String("foo"),
+					Delta: proto.Uint64(5),
+				},
+			))
+		})
+	})
 })
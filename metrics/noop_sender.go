@@ -2,10 +2,33 @@ package metrics
 
 import "time"
 
+// NoOpMetricsSender has the methods of MetricsSender and discards everything.
 type NoOpMetricsSender struct{}
 
 func (s *NoOpMetricsSender) SendDuration(string, time.Duration) {
+}
+
+func (s *NoOpMetricsSender) SendDurationWithTags(string, time.Duration, map[string]string) {
+}
 
+func (s *NoOpMetricsSender) SendValue(string, float64, string) {
 }
+
+func (s *NoOpMetricsSender) SendValueWithTags(string, float64, string, map[string]string) {
+}
+
 func (s *NoOpMetricsSender) IncrementCounter(string) {
 }
+
+func (s *NoOpMetricsSender) IncrementCounterWithTags(string, map[string]string) {
+}
+
+func (s *NoOpMetricsSender) AddToCounter(string, uint64) {
+}
+
+func (s *NoOpMetricsSender) AddToCounterWithTags(string, uint64, map[string]string) {
+}
+
+func (s *NoOpMetricsSender) SendErrors() uint64 {
+	return 0
+}
@@ -0,0 +1,539 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/mutualtls"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	DefaultOTLPBatchSize     = 512
+	DefaultOTLPBufferSize    = 10000
+	DefaultOTLPFlushInterval = 5 * time.Second
+	DefaultOTLPSendTimeout   = 10 * time.Second
+
+	otlpScopeName = "code.cloudfoundry.org/cf-networking-helpers"
+
+	otlpTemporalityDelta = 1
+	otlpStatusError      = 2
+
+	// otlpCounterStartExpiry is how many flush intervals a counter series
+	// may go unsent before its start time is forgotten, so that series that
+	// are no longer sent do not pile up. It then starts afresh.
+	otlpCounterStartExpiry = 10
+)
+
+type OTLPConfig struct {
+	// Endpoint is the collector's OTLP/HTTP base URL, e.g.
+	// https://127.0.0.1:4318. Metrics and spans are posted to /v1/metrics
+	// and /v1/traces.
+	Endpoint   string
+	ServerName string
+	// CACertFile verifies the collector's certificate. It is used with or
+	// without a client certificate.
+	CACertFile string
+	// Client certificates are only used if CertFile is set.
+	CertFile string
+	KeyFile  string
+
+	ResourceAttributes map[string]string
+
+	BatchSize     int
+	BufferSize    int
+	FlushInterval time.Duration
+	SendTimeout   time.Duration
+}
+
+func (c OTLPConfig) WithDefaults() OTLPConfig {
+	if c.BatchSize <= 0 {
+		c.BatchSize = DefaultOTLPBatchSize
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = DefaultOTLPBufferSize
+	}
+	if c.BufferSize < c.BatchSize {
+		c.BufferSize = c.BatchSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultOTLPFlushInterval
+	}
+	if c.SendTimeout <= 0 {
+		c.SendTimeout = DefaultOTLPSendTimeout
+	}
+	return c
+}
+
+// OTLPExporter sends metrics and spans to an OpenTelemetry collector over
+// OTLP/HTTP with JSON encoding. It is a TaggedSink for MetricsSender and
+// MetricsEmitter and a tracing.SpanRecorder for the middleware and db
+// packages. Gauges are sent as gauges, counters as delta sums and durations
+// as single-observation delta histograms in ms. Like LoggregatorSink it
+// queues everything and sends batches from Run; batches that fail to send stay
+// queued and the oldest items are dropped beyond BufferSize.
+type OTLPExporter struct {
+	config   OTLPConfig
+	logger   lager.Logger
+	client   *http.Client
+	resource otlpResource
+
+	flushLock     sync.Mutex
+	lock          sync.Mutex
+	metrics       []otlpMetric
+	spans         []otlpSpan
+	counterStarts map[string]time.Time
+	dropped       uint64
+	batchReady    chan struct{}
+}
+
+func NewOTLPExporter(config OTLPConfig, logger lager.Logger) (*OTLPExporter, error) {
+	config = config.WithDefaults()
+
+	transport := &http.Transport{}
+	if config.CertFile != "" || config.CACertFile != "" {
+		tlsConfig, err := newOTLPTLSConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("otlp tls config: %s", err)
+		}
+		tlsConfig.ServerName = config.ServerName
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &OTLPExporter{
+		config:        config,
+		logger:        logger,
+		client:        &http.Client{Transport: transport},
+		resource:      otlpResource{Attributes: otlpAttributes(config.ResourceAttributes)},
+		counterStarts: map[string]time.Time{},
+		batchReady:    make(chan struct{}, 1),
+	}, nil
+}
+
+func newOTLPTLSConfig(config OTLPConfig) (*tls.Config, error) {
+	if config.CertFile != "" {
+		return mutualtls.NewClientTLSConfig(config.CertFile, config.KeyFile, config.CACertFile)
+	}
+	return mutualtls.NewClientTLSConfigWithoutCert(config.CACertFile)
+}
+
+func (e *OTLPExporter) SendGauge(name string, value float64, unit string) error {
+	return e.SendGaugeWithTags(name, value, unit, nil)
+}
+
+func (e *OTLPExporter) AddToCounter(name string, delta uint64) error {
+	return e.AddToCounterWithTags(name, delta, nil)
+}
+
+func (e *OTLPExporter) SendDuration(name string, duration time.Duration) error {
+	return e.SendDurationWithTags(name, duration, nil)
+}
+
+func (e *OTLPExporter) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	e.enqueueMetric(otlpMetric{
+		Name: name,
+		Unit: unit,
+		Gauge: &otlpGauge{DataPoints: []otlpNumberDataPoint{{
+			Attributes:   otlpAttributes(tags),
+			TimeUnixNano: otlpTime(time.Now()),
+			AsDouble:     &value,
+		}}},
+	})
+	return nil
+}
+
+// AddToCounterWithTags sends the delta since the previous call for the same
+// counter and tags, if there was one in the last otlpCounterStartExpiry
+// flush intervals.
+func (e *OTLPExporter) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	now := time.Now()
+	series := FlattenTags(name, tags)
+
+	e.lock.Lock()
+	start, ok := e.counterStarts[series]
+	if !ok {
+		start = now
+	}
+	e.counterStarts[series] = now
+	e.lock.Unlock()
+
+	e.enqueueMetric(otlpMetric{
+		Name: name,
+		Sum: &otlpSum{
+			DataPoints: []otlpNumberDataPoint{{
+				Attributes:        otlpAttributes(tags),
+				StartTimeUnixNano: otlpTime(start),
+				TimeUnixNano:      otlpTime(now),
+				AsInt:             strconv.FormatUint(delta, 10),
+			}},
+			AggregationTemporality: otlpTemporalityDelta,
+			IsMonotonic:            true,
+		},
+	})
+	return nil
+}
+
+func (e *OTLPExporter) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	stop := time.Now()
+	e.enqueueMetric(otlpMetric{
+		Name: name,
+		Unit: "ms",
+		Histogram: &otlpHistogram{
+			DataPoints: []otlpHistogramDataPoint{{
+				Attributes:        otlpAttributes(tags),
+				StartTimeUnixNano: otlpTime(stop.Add(-duration)),
+				TimeUnixNano:      otlpTime(stop),
+				Count:             "1",
+				Sum:               durationMillis(duration),
+				BucketCounts:      []string{"1"},
+				ExplicitBounds:    []float64{},
+			}},
+			AggregationTemporality: otlpTemporalityDelta,
+		},
+	})
+	return nil
+}
+
+func (e *OTLPExporter) RecordSpan(span tracing.Span) {
+	s := otlpSpan{
+		TraceID:           span.TraceID.String(),
+		SpanID:            span.SpanID.String(),
+		Name:              span.Name,
+		Kind:              int(span.Kind),
+		StartTimeUnixNano: otlpTime(span.Start),
+		EndTimeUnixNano:   otlpTime(span.End),
+		Attributes:        otlpAttributes(span.Attributes),
+	}
+	if span.ParentSpanID.IsValid() {
+		s.ParentSpanID = span.ParentSpanID.String()
+	}
+	if span.Err != nil {
+		s.Status = otlpStatus{Code: otlpStatusError, Message: span.Err.Error()}
+	}
+
+	e.lock.Lock()
+	e.spans = append(e.spans, s)
+	e.trimLocked()
+	ready := len(e.spans) >= e.config.BatchSize
+	e.lock.Unlock()
+
+	if ready {
+		e.signalBatchReady()
+	}
+}
+
+// Dropped returns how many metrics and spans were discarded because the
+// buffer was full.
+func (e *OTLPExporter) Dropped() uint64 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.dropped
+}
+
+func (e *OTLPExporter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(e.config.FlushInterval)
+	defer ticker.Stop()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			if err := e.Flush(); err != nil {
+				e.logger.Error("otlp-final-flush", err)
+			}
+			e.client.CloseIdleConnections()
+			return nil
+		case <-ticker.C:
+		case <-e.batchReady:
+		}
+
+		if err := e.Flush(); err != nil {
+			e.logger.Error("otlp-send", err)
+		}
+	}
+}
+
+// Flush sends everything queued. On failure the unsent metrics and spans
+// stay queued for the next attempt.
+func (e *OTLPExporter) Flush() error {
+	e.flushLock.Lock()
+	defer e.flushLock.Unlock()
+
+	e.pruneCounterStarts(time.Now().Add(-otlpCounterStartExpiry * e.config.FlushInterval))
+
+	var errs []string
+	if err := e.flushMetrics(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if err := e.flushSpans(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (e *OTLPExporter) flushMetrics() error {
+	for {
+		e.lock.Lock()
+		n := len(e.metrics)
+		if n > e.config.BatchSize {
+			n = e.config.BatchSize
+		}
+		batch := e.metrics[:n:n]
+		e.metrics = e.metrics[n:]
+		e.lock.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := e.post("/v1/metrics", otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+			Resource:     e.resource,
+			ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: otlpScopeName}, Metrics: batch}},
+		}}})
+		if err != nil {
+			e.lock.Lock()
+			e.metrics = append(batch, e.metrics...)
+			e.trimLocked()
+			e.lock.Unlock()
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) flushSpans() error {
+	for {
+		e.lock.Lock()
+		n := len(e.spans)
+		if n > e.config.BatchSize {
+			n = e.config.BatchSize
+		}
+		batch := e.spans[:n:n]
+		e.spans = e.spans[n:]
+		e.lock.Unlock()
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		err := e.post("/v1/traces", otlpTracesRequest{ResourceSpans: []otlpResourceSpans{{
+			Resource:   e.resource,
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: otlpScopeName}, Spans: batch}},
+		}}})
+		if err != nil {
+			e.lock.Lock()
+			e.spans = append(batch, e.spans...)
+			e.trimLocked()
+			e.lock.Unlock()
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) post(path string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("otlp marshal: %s", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), e.config.SendTimeout)
+	defer cancel()
+
+	url := strings.TrimSuffix(e.config.Endpoint, "/") + path
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("otlp request: %s", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := e.client.Do(request)
+	if err != nil {
+		return fmt.Errorf("otlp export: %s", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp export %s: unexpected status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+func (e *OTLPExporter) pruneCounterStarts(before time.Time) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for series, last := range e.counterStarts {
+		if last.Before(before) {
+			delete(e.counterStarts, series)
+		}
+	}
+}
+
+func (e *OTLPExporter) enqueueMetric(metric otlpMetric) {
+	e.lock.Lock()
+	e.metrics = append(e.metrics, metric)
+	e.trimLocked()
+	ready := len(e.metrics) >= e.config.BatchSize
+	e.lock.Unlock()
+
+	if ready {
+		e.signalBatchReady()
+	}
+}
+
+func (e *OTLPExporter) signalBatchReady() {
+	select {
+	case e.batchReady <- struct{}{}:
+	default:
+	}
+}
+
+func (e *OTLPExporter) trimLocked() {
+	if excess := len(e.metrics) - e.config.BufferSize; excess > 0 {
+		e.metrics = e.metrics[excess:]
+		e.dropped += uint64(excess)
+	}
+	if excess := len(e.spans) - e.config.BufferSize; excess > 0 {
+		e.spans = e.spans[excess:]
+		e.dropped += uint64(excess)
+	}
+}
+
+func otlpTime(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func otlpAttributes(tags map[string]string) []otlpKeyValue {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	attributes := []otlpKeyValue{}
+	for _, k := range keys {
+		attributes = append(attributes, otlpKeyValue{Key: k, Value: otlpAnyValue{StringValue: tags[k]}})
+	}
+	return attributes
+}
+
+// The types below are the parts of the OTLP JSON encoding the exporter
+// uses. 64-bit integers are encoded as strings and ids as hex.
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name      string         `json:"name"`
+	Unit      string         `json:"unit,omitempty"`
+	Gauge     *otlpGauge     `json:"gauge,omitempty"`
+	Sum       *otlpSum       `json:"sum,omitempty"`
+	Histogram *otlpHistogram `json:"histogram,omitempty"`
+}
+
+type otlpGauge struct {
+	DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+}
+
+type otlpSum struct {
+	DataPoints             []otlpNumberDataPoint `json:"dataPoints"`
+	AggregationTemporality int                   `json:"aggregationTemporality"`
+	IsMonotonic            bool                  `json:"isMonotonic"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          *float64       `json:"asDouble,omitempty"`
+	AsInt             string         `json:"asInt,omitempty"`
+}
+
+type otlpHistogram struct {
+	DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+	AggregationTemporality int                      `json:"aggregationTemporality"`
+}
+
+type otlpHistogramDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	Count             string         `json:"count"`
+	Sum               float64        `json:"sum"`
+	BucketCounts      []string       `json:"bucketCounts"`
+	ExplicitBounds    []float64      `json:"explicitBounds"`
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
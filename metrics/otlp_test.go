@@ -0,0 +1,244 @@
+package metrics_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+	testmetrics "code.cloudfoundry.org/cf-networking-helpers/testsupport/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("OTLPExporter", func() {
+	var (
+		certDir        string
+		serverCertPath string
+		serverKeyPath  string
+		collector      *testmetrics.FakeOTLPCollector
+		config         metrics.OTLPConfig
+		exporter       *metrics.OTLPExporter
+		process        ifrit.Process
+	)
+
+	BeforeEach(func() {
+		var err error
+		certDir, err = ioutil.TempDir("", "otlp-certs")
+		Expect(err).NotTo(HaveOccurred())
+
+		certWriter, err := testsupport.NewCertWriter(certDir)
+		Expect(err).NotTo(HaveOccurred())
+		caCertPath, err := certWriter.WriteCA("otlp-ca")
+		Expect(err).NotTo(HaveOccurred())
+		serverCertPath, serverKeyPath, err = certWriter.WriteAndSign("collector", "otlp-ca")
+		Expect(err).NotTo(HaveOccurred())
+		clientCertPath, clientKeyPath, err := certWriter.WriteAndSign("client", "otlp-ca")
+		Expect(err).NotTo(HaveOccurred())
+
+		collector, err = testmetrics.NewFakeOTLPCollector(serverCertPath, serverKeyPath, caCertPath)
+		Expect(err).NotTo(HaveOccurred())
+
+		config = metrics.OTLPConfig{
+			Endpoint:           collector.Endpoint(),
+			ServerName:         "collector",
+			CACertFile:         caCertPath,
+			CertFile:           clientCertPath,
+			KeyFile:            clientKeyPath,
+			ResourceAttributes: map[string]string{"service.name": "policy-server", "service.instance.id": "0"},
+			FlushInterval:      50 * time.Millisecond,
+			SendTimeout:        time.Second,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		exporter, err = metrics.NewOTLPExporter(config, lagertest.NewTestLogger("test"))
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(exporter)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		collector.Close()
+		os.RemoveAll(certDir)
+	})
+
+	It("exports gauges, counters and durations with the resource attributes", func() {
+		Expect(exporter.SendGauge("queueDepth", 7, "count")).To(Succeed())
+		Expect(exporter.AddToCounterWithTags("requests", 3, map[string]string{"status": "200"})).To(Succeed())
+		Expect(exporter.SendDuration("requestTime", 2*time.Millisecond)).To(Succeed())
+
+		Eventually(collector.AllEvents).Should(ConsistOf(
+			testmetrics.Event{EventType: "Gauge", Name: "queueDepth", Origin: "policy-server", Value: 7},
+			testmetrics.Event{EventType: "Counter", Name: "requests", Origin: "policy-server", Value: 3},
+			testmetrics.Event{EventType: "Timer", Name: "requestTime", Origin: "policy-server", Value: float64(2 * time.Millisecond)},
+		))
+
+		received := collector.AllMetrics()
+		Expect(received[0].Unit).To(Equal("count"))
+		Expect(received[0].Resource).To(HaveKeyWithValue("service.instance.id", "0"))
+		Expect(received[1].Attributes).To(Equal(map[string]string{"status": "200"}))
+		Expect(received[2].Unit).To(Equal("ms"))
+	})
+
+	It("exports the values of an emitter's sources", func() {
+		emitter := metrics.NewMetricsEmitterWithSink(lagertest.NewTestLogger("test"), time.Hour, exporter, metrics.MetricSource{
+			Name:   "openConnections",
+			Tags:   map[string]string{"database": "policy"},
+			Getter: func() (float64, error) { return 4, nil },
+		})
+		emitterProcess := ifrit.Invoke(emitter)
+		emitterProcess.Signal(os.Interrupt)
+		Eventually(emitterProcess.Wait()).Should(Receive())
+
+		Eventually(collector.AllMetrics).Should(ConsistOf(testmetrics.OTLPMetric{
+			Type:       "gauge",
+			Name:       "openConnections",
+			Value:      4,
+			Attributes: map[string]string{"database": "policy"},
+			Resource:   map[string]string{"service.name": "policy-server", "service.instance.id": "0"},
+		}))
+	})
+
+	It("exports spans", func() {
+		parent := tracing.StartSpan("GET /policies", tracing.SpanKindServer, nil)
+		child := tracing.StartSpan("db.query", tracing.SpanKindClient, &parent)
+		child.Attributes = map[string]string{"db.statement": "SELECT 1"}
+		child.Err = errors.New("potato")
+		child.End = time.Now()
+		parent.End = time.Now()
+		exporter.RecordSpan(child)
+		exporter.RecordSpan(parent)
+
+		Eventually(collector.AllSpans).Should(HaveLen(2))
+		spans := collector.AllSpans()
+		Expect(spans[0]).To(Equal(testmetrics.OTLPSpan{
+			TraceID:       parent.TraceID.String(),
+			SpanID:        child.SpanID.String(),
+			ParentSpanID:  parent.SpanID.String(),
+			Name:          "db.query",
+			Kind:          3,
+			StatusCode:    2,
+			StatusMessage: "potato",
+			Attributes:    map[string]string{"db.statement": "SELECT 1"},
+			Resource:      map[string]string{"service.name": "policy-server", "service.instance.id": "0"},
+		}))
+		Expect(spans[1].ParentSpanID).To(BeEmpty())
+		Expect(spans[1].Kind).To(Equal(2))
+	})
+
+	Context("when only a CA cert is configured", func() {
+		BeforeEach(func() {
+			collector.Close()
+
+			var err error
+			collector, err = testmetrics.NewServerAuthFakeOTLPCollector(serverCertPath, serverKeyPath)
+			Expect(err).NotTo(HaveOccurred())
+
+			config.Endpoint = collector.Endpoint()
+			config.CertFile = ""
+			config.KeyFile = ""
+		})
+
+		It("verifies the collector with it", func() {
+			Expect(exporter.SendGauge("queueDepth", 7, "count")).To(Succeed())
+
+			Eventually(collector.AllEvents).Should(ConsistOf(
+				testmetrics.Event{EventType: "Gauge", Name: "queueDepth", Origin: "policy-server", Value: 7},
+			))
+		})
+	})
+
+	Describe("counter intervals", func() {
+		intervals := func() []time.Duration {
+			intervals := []time.Duration{}
+			for _, metric := range collector.AllMetrics() {
+				intervals = append(intervals, metric.Interval)
+			}
+			return intervals
+		}
+
+		It("start each counter where its previous delta ended", func() {
+			Expect(exporter.AddToCounter("requests", 1)).To(Succeed())
+			time.Sleep(10 * time.Millisecond)
+			Expect(exporter.AddToCounter("requests", 1)).To(Succeed())
+
+			Eventually(intervals).Should(HaveLen(2))
+			Expect(intervals()[0]).To(BeZero())
+			Expect(intervals()[1]).To(BeNumerically(">=", 10*time.Millisecond))
+		})
+
+		It("start afresh once the counter has not been sent for a while", func() {
+			Expect(exporter.AddToCounter("requests", 1)).To(Succeed())
+			time.Sleep(15 * config.FlushInterval)
+			Expect(exporter.AddToCounter("requests", 1)).To(Succeed())
+
+			Eventually(intervals).Should(Equal([]time.Duration{0, 0}))
+		})
+	})
+
+	Context("when a batch fills up", func() {
+		BeforeEach(func() {
+			config.BatchSize = 2
+			config.FlushInterval = time.Hour
+		})
+
+		It("sends it without waiting for the flush interval", func() {
+			Expect(exporter.AddToCounter("a", 1)).To(Succeed())
+			Consistently(collector.AllMetrics, 200*time.Millisecond).Should(BeEmpty())
+
+			Expect(exporter.AddToCounter("b", 1)).To(Succeed())
+			Eventually(collector.AllMetrics).Should(HaveLen(2))
+		})
+	})
+
+	Context("when the collector is unavailable", func() {
+		BeforeEach(func() {
+			config.BatchSize = 2
+			config.BufferSize = 2
+			config.FlushInterval = time.Hour
+		})
+
+		It("keeps what it could not send and drops the oldest beyond the buffer", func() {
+			collector.SetFailing(true)
+			for _, name := range []string{"a", "b", "c"} {
+				Expect(exporter.AddToCounter(name, 1)).To(Succeed())
+			}
+			Expect(exporter.Flush()).To(MatchError(ContainSubstring("unexpected status 503")))
+			Expect(exporter.Dropped()).To(Equal(uint64(1)))
+
+			collector.SetFailing(false)
+			Expect(exporter.Flush()).To(Succeed())
+			names := func() []string {
+				names := []string{}
+				for _, metric := range collector.AllMetrics() {
+					names = append(names, metric.Name)
+				}
+				return names
+			}
+			Eventually(names).Should(Equal([]string{"b", "c"}))
+		})
+	})
+
+	Context("when signalled", func() {
+		BeforeEach(func() {
+			config.FlushInterval = time.Hour
+		})
+
+		It("flushes what is left", func() {
+			Expect(exporter.AddToCounter("last", 1)).To(Succeed())
+
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive(BeNil()))
+			Expect(collector.AllMetrics()).To(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,51 @@
+package metrics
+
+const procSelf = "/proc/self"
+
+// NewProcessSources reports the process's open file descriptors and their
+// limit, resident memory, CPU time and thread count as seen in /proc/self.
+// Outside Linux every getter returns an error.
+func NewProcessSources() []MetricSource {
+	return []MetricSource{
+		{
+			Name:   "openFileDescriptors",
+			Unit:   "",
+			Getter: openFileDescriptors,
+		},
+		{
+			Name:   "maxFileDescriptors",
+			Unit:   "",
+			Getter: maxFileDescriptors,
+		},
+		{
+			Name: "residentMemory",
+			Unit: "bytes",
+			Getter: func() (float64, error) {
+				stat, err := readProcStat()
+				return stat.residentBytes, err
+			},
+		},
+		{
+			Name: "cpuSeconds",
+			Unit: "seconds",
+			Getter: func() (float64, error) {
+				stat, err := readProcStat()
+				return stat.cpuSeconds, err
+			},
+		},
+		{
+			Name: "threads",
+			Unit: "",
+			Getter: func() (float64, error) {
+				stat, err := readProcStat()
+				return stat.threads, err
+			},
+		},
+	}
+}
+
+type procStat struct {
+	residentBytes float64
+	cpuSeconds    float64
+	threads       float64
+}
@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// userHZ is the unit of the CPU times in /proc/self/stat. It is 100 on
+// every architecture Linux supports.
+const userHZ = 100
+
+// openFileDescriptors counts the entries of /proc/self/fd, less the one for
+// the descriptor used to read it.
+func openFileDescriptors() (float64, error) {
+	dir, err := os.Open(procSelf + "/fd")
+	if err != nil {
+		return 0, fmt.Errorf("reading open file descriptors: %s", err)
+	}
+	defer dir.Close()
+
+	fds, err := dir.Readdirnames(-1)
+	if err != nil {
+		return 0, fmt.Errorf("reading open file descriptors: %s", err)
+	}
+	return float64(len(fds) - 1), nil
+}
+
+func maxFileDescriptors() (float64, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &limit); err != nil {
+		return 0, fmt.Errorf("getting file descriptor limit: %s", err)
+	}
+	return float64(limit.Cur), nil
+}
+
+func readProcStat() (procStat, error) {
+	contents, err := ioutil.ReadFile(procSelf + "/stat")
+	if err != nil {
+		return procStat{}, fmt.Errorf("reading process stat: %s", err)
+	}
+	return parseProcStat(string(contents))
+}
+
+// parseProcStat reads utime, stime, num_threads and rss (fields 14, 15, 20
+// and 24 of proc(5)). The command name in field 2 may contain spaces, so
+// fields are counted from its closing parenthesis.
+func parseProcStat(stat string) (procStat, error) {
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return procStat{}, fmt.Errorf("parsing process stat: no command name")
+	}
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("parsing process stat: only %d fields", len(fields)+2)
+	}
+
+	field := func(n int) (float64, error) {
+		value, err := strconv.ParseFloat(fields[n-3], 64)
+		if err != nil {
+			return 0, fmt.Errorf("parsing process stat field %d: %s", n, err)
+		}
+		return value, nil
+	}
+
+	var values [4]float64
+	for i, n := range []int{14, 15, 20, 24} {
+		value, err := field(n)
+		if err != nil {
+			return procStat{}, err
+		}
+		values[i] = value
+	}
+	return procStat{
+		cpuSeconds:    (values[0] + values[1]) / userHZ,
+		threads:       values[2],
+		residentBytes: values[3] * float64(os.Getpagesize()),
+	}, nil
+}
@@ -0,0 +1,57 @@
+package metrics_test
+
+import (
+	"os"
+	"syscall"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ProcessSources", func() {
+	var sources map[string]metrics.MetricSource
+
+	BeforeEach(func() {
+		sources = map[string]metrics.MetricSource{}
+		for _, source := range metrics.NewProcessSources() {
+			sources[source.Name] = source
+		}
+	})
+
+	value := func(name string) float64 {
+		source, ok := sources[name]
+		Expect(ok).To(BeTrue(), name)
+		value, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	It("reports open file descriptors and their limit", func() {
+		f, err := os.Open(os.DevNull)
+		Expect(err).NotTo(HaveOccurred())
+		defer f.Close()
+
+		open := value("openFileDescriptors")
+		Expect(open).To(BeNumerically(">", float64(f.Fd())))
+		Expect(value("maxFileDescriptors")).To(BeNumerically(">=", open))
+	})
+
+	It("counts exactly the descriptors the process has open", func() {
+		expected := 0
+		for fd := 0; fd < 4096; fd++ {
+			_, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_GETFD, 0)
+			if errno == 0 {
+				expected++
+			}
+		}
+		Expect(value("openFileDescriptors")).To(Equal(float64(expected)))
+	})
+
+	It("reports resident memory, CPU time and threads", func() {
+		Expect(value("residentMemory")).To(BeNumerically(">", 1024*1024))
+		Expect(value("cpuSeconds")).To(BeNumerically(">=", 0))
+		Expect(value("threads")).To(BeNumerically(">=", 1))
+	})
+})
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package metrics
+
+import "errors"
+
+var errProcessSourcesUnsupported = errors.New("process metrics are only available on linux")
+
+func openFileDescriptors() (float64, error) {
+	return 0, errProcessSourcesUnsupported
+}
+
+func maxFileDescriptors() (float64, error) {
+	return 0, errProcessSourcesUnsupported
+}
+
+func readProcStat() (procStat, error) {
+	return procStat{}, errProcessSourcesUnsupported
+}
@@ -0,0 +1,235 @@
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// PrometheusHandler serves the values of its metric sources, and whatever is
+// sent to it as a Sink, in the Prometheus text exposition format. Getters
+// are called concurrently and waited for up to their Timeout, or
+// DefaultGetterTimeout without one. When metrics of different types end up
+// with the same name, only the first type in alphabetical order is served.
+type PrometheusHandler struct {
+	Namespace string
+
+	logger  lager.Logger
+	sources []MetricSource
+
+	lock     sync.Mutex
+	recorded map[string]prometheusMetric // keyed on type, name and labels
+}
+
+type prometheusMetric struct {
+	name       string
+	labels     string
+	metricType string
+	value      float64
+}
+
+func NewPrometheusHandler(logger lager.Logger, sources ...MetricSource) *PrometheusHandler {
+	return &PrometheusHandler{
+		logger:   logger,
+		sources:  sources,
+		recorded: map[string]prometheusMetric{},
+	}
+}
+
+func (h *PrometheusHandler) SendGauge(name string, value float64, unit string) error {
+	return h.SendGaugeWithTags(name, value, unit, nil)
+}
+
+func (h *PrometheusHandler) SendDuration(name string, duration time.Duration) error {
+	return h.SendDurationWithTags(name, duration, nil)
+}
+
+func (h *PrometheusHandler) AddToCounter(name string, delta uint64) error {
+	return h.AddToCounterWithTags(name, delta, nil)
+}
+
+func (h *PrometheusHandler) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	name, value = prometheusName(name, unit, value)
+	h.record(name, prometheusLabels(tags), "gauge", func(float64) float64 { return value })
+	return nil
+}
+
+func (h *PrometheusHandler) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	return h.SendGaugeWithTags(name, duration.Seconds(), "seconds", tags)
+}
+
+func (h *PrometheusHandler) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	name = sanitizePrometheusName(name)
+	if !strings.HasSuffix(name, "_total") {
+		name += "_total"
+	}
+	h.record(name, prometheusLabels(tags), "counter", func(current float64) float64 { return current + float64(delta) })
+	return nil
+}
+
+func (h *PrometheusHandler) record(name, labels, metricType string, update func(float64) float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	key := metricType + " " + name + labels
+	current := h.recorded[key]
+	h.recorded[key] = prometheusMetric{
+		name:       name,
+		labels:     labels,
+		metricType: metricType,
+		value:      update(current.value),
+	}
+}
+
+func (h *PrometheusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	series := map[string]prometheusMetric{}
+
+	h.lock.Lock()
+	for key, metric := range h.recorded {
+		series[key] = metric
+	}
+	h.lock.Unlock()
+
+	results := getValues(clock.NewClock(), h.sources, DefaultGetterTimeout)
+	for i, source := range h.sources {
+		result := results[i]
+		if result.timedOut {
+			h.logger.Error("metric-getter-timeout", result.err, lager.Data{"source": source.Name})
+			continue
+		}
+		if result.err != nil {
+			h.logger.Error("metric-getter", result.err, lager.Data{"source": source.Name})
+			continue
+		}
+		name, value := prometheusName(source.Name, source.Unit, result.value)
+		labels := prometheusLabels(source.Tags)
+		series["gauge "+name+labels] = prometheusMetric{name: name, labels: labels, metricType: "gauge", value: value}
+	}
+
+	metrics := make([]prometheusMetric, 0, len(series))
+	for _, metric := range series {
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].name != metrics[j].name {
+			return metrics[i].name < metrics[j].name
+		}
+		if metrics[i].metricType != metrics[j].metricType {
+			return metrics[i].metricType < metrics[j].metricType
+		}
+		return metrics[i].labels < metrics[j].labels
+	})
+
+	var body bytes.Buffer
+	var lastName, lastType string
+	for _, metric := range metrics {
+		if metric.name == lastName && metric.metricType != lastType {
+			h.logger.Error("metric-type-conflict", fmt.Errorf("%s is already a %s", metric.name, lastType), lager.Data{
+				"metric": metric.name + metric.labels,
+				"type":   metric.metricType,
+			})
+			continue
+		}
+
+		fullName := metric.name
+		if h.Namespace != "" {
+			fullName = sanitizePrometheusName(h.Namespace) + "_" + metric.name
+		}
+		if metric.name != lastName {
+			fmt.Fprintf(&body, "# TYPE %s %s\n", fullName, metric.metricType)
+			lastName, lastType = metric.name, metric.metricType
+		}
+		fmt.Fprintf(&body, "%s%s %s\n", fullName, metric.labels, formatPrometheusValue(metric.value))
+	}
+
+	w.Header().Set("Content-Type", prometheusContentType)
+	w.Write(body.Bytes())
+}
+
+// prometheusName sanitises name and appends the unit as a suffix, converting
+// the value to the Prometheus base unit where needed.
+func prometheusName(name, unit string, value float64) (string, float64) {
+	name = sanitizePrometheusName(name)
+
+	switch unit {
+	case "ms":
+		unit, value = "seconds", value/1000
+	case "ns":
+		unit, value = "seconds", value/1e9
+	case "%":
+		unit = "percent"
+	}
+
+	unit = strings.Trim(sanitizePrometheusName(unit), "_")
+	if unit != "" && !strings.HasSuffix(name, "_"+unit) {
+		name += "_" + unit
+	}
+	return name, value
+}
+
+// prometheusLabels renders tags as a sorted label set, e.g. {method="GET"}.
+func prometheusLabels(tags map[string]string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	labels := make([]string, 0, len(keys))
+	for _, k := range keys {
+		labels = append(labels, fmt.Sprintf(`%s="%s"`, sanitizePrometheusLabelName(k), prometheusLabelEscaper.Replace(tags[k])))
+	}
+	return "{" + strings.Join(labels, ",") + "}"
+}
+
+func sanitizePrometheusName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteRune('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+// sanitizePrometheusLabelName is sanitizePrometheusName without colons,
+// which are only valid in metric names.
+func sanitizePrometheusLabelName(name string) string {
+	return strings.Replace(sanitizePrometheusName(name), ":", "_", -1)
+}
+
+func formatPrometheusValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,51 @@
+package metrics
+
+import (
+	"net"
+	"net/http"
+	"os"
+
+	"code.cloudfoundry.org/lager"
+)
+
+type PrometheusServer struct {
+	address string
+	handler *PrometheusHandler
+	logger  lager.Logger
+}
+
+func NewPrometheusServer(address string, handler *PrometheusHandler, logger lager.Logger) *PrometheusServer {
+	return &PrometheusServer{
+		address: address,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+func (s *PrometheusServer) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	listener, err := net.Listen("tcp", s.address)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.handler)
+	httpServer := &http.Server{Handler: mux}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- httpServer.Serve(listener)
+	}()
+
+	s.logger.Info("prometheus-server-started", lager.Data{"address": listener.Addr().String()})
+	close(ready)
+
+	select {
+	case err := <-exited:
+		s.logger.Error("prometheus-server-exited", err)
+		return err
+	case <-signals:
+		httpServer.Close()
+		return nil
+	}
+}
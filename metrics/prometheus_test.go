@@ -0,0 +1,233 @@
+package metrics_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("PrometheusHandler", func() {
+	var (
+		logger  *lagertest.TestLogger
+		handler *metrics.PrometheusHandler
+	)
+
+	scrape := func() (*httptest.ResponseRecorder, string) {
+		resp := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+		handler.ServeHTTP(resp, request)
+		return resp, resp.Body.String()
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		handler = metrics.NewPrometheusHandler(logger,
+			metrics.MetricSource{
+				Name:   "uptime",
+				Unit:   "seconds",
+				Getter: func() (float64, error) { return 42, nil },
+			},
+			metrics.MetricSource{
+				Name:   "DBOpenConnections",
+				Unit:   "",
+				Getter: func() (float64, error) { return 3, nil },
+			},
+			metrics.MetricSource{
+				Name:   "some.bad-name",
+				Unit:   "ms",
+				Getter: func() (float64, error) { return 1500, nil },
+			},
+		)
+	})
+
+	It("serves the metric sources as sorted gauges", func() {
+		resp, body := scrape()
+		Expect(resp.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(body).To(Equal(`# TYPE DBOpenConnections gauge
+DBOpenConnections 3
+# TYPE some_bad_name_seconds gauge
+some_bad_name_seconds 1.5
+# TYPE uptime_seconds gauge
+uptime_seconds 42
+`))
+	})
+
+	It("serves gauges, durations and counters sent to it", func() {
+		handler = metrics.NewPrometheusHandler(logger)
+		Expect(handler.SendGauge("queueDepth", 7, "")).To(Succeed())
+		Expect(handler.SendDuration("requestTime", 250*time.Millisecond)).To(Succeed())
+		Expect(handler.AddToCounter("requestCount", 1)).To(Succeed())
+		Expect(handler.AddToCounter("requestCount", 1)).To(Succeed())
+
+		_, body := scrape()
+		Expect(body).To(Equal(`# TYPE queueDepth gauge
+queueDepth 7
+# TYPE requestCount_total counter
+requestCount_total 2
+# TYPE requestTime_seconds gauge
+requestTime_seconds 0.25
+`))
+	})
+
+	It("prefixes names with the namespace", func() {
+		handler = metrics.NewPrometheusHandler(logger, metrics.MetricSource{
+			Name:   "uptime",
+			Unit:   "seconds",
+			Getter: func() (float64, error) { return 1, nil },
+		})
+		handler.Namespace = "policy-server"
+
+		_, body := scrape()
+		Expect(body).To(ContainSubstring("policy_server_uptime_seconds 1\n"))
+	})
+
+	It("formats special float values", func() {
+		handler = metrics.NewPrometheusHandler(logger)
+		handler.SendGauge("inf", math.Inf(1), "")
+		handler.SendGauge("nan", math.NaN(), "")
+
+		_, body := scrape()
+		Expect(body).To(ContainSubstring("inf +Inf\n"))
+		Expect(body).To(ContainSubstring("nan NaN\n"))
+	})
+
+	It("sanitises names that start with a digit", func() {
+		handler = metrics.NewPrometheusHandler(logger)
+		handler.SendGauge("5xxCount", 1, "")
+
+		_, body := scrape()
+		Expect(body).To(ContainSubstring("_5xxCount 1\n"))
+	})
+
+	It("replaces colons in label names", func() {
+		handler = metrics.NewPrometheusHandler(logger)
+		handler.SendGaugeWithTags("queueDepth", 7, "", map[string]string{"app:name": "a:b"})
+
+		_, body := scrape()
+		Expect(body).To(ContainSubstring(`queueDepth{app_name="a:b"} 7` + "\n"))
+	})
+
+	Context("when metrics of different types have the same name", func() {
+		It("serves the first type only and logs the rest", func() {
+			handler = metrics.NewPrometheusHandler(logger)
+			handler.SendGauge("requestCount_total", 3, "")
+			handler.AddToCounter("requestCount", 1)
+
+			_, body := scrape()
+			Expect(body).To(Equal(`# TYPE requestCount_total counter
+requestCount_total 1
+`))
+			Expect(logger).To(gbytes.Say("metric-type-conflict.*requestCount_total is already a counter"))
+		})
+	})
+
+	Context("when a getter fails", func() {
+		BeforeEach(func() {
+			handler = metrics.NewPrometheusHandler(logger, metrics.MetricSource{
+				Name:   "badSource",
+				Getter: func() (float64, error) { return 0, errors.New("potato") },
+			})
+		})
+
+		It("logs the error and leaves the metric out", func() {
+			_, body := scrape()
+			Expect(body).NotTo(ContainSubstring("badSource"))
+			Expect(logger).To(gbytes.Say("metric-getter.*potato.*badSource"))
+		})
+	})
+
+	Context("when a getter does not return in time", func() {
+		var release chan struct{}
+
+		BeforeEach(func() {
+			release = make(chan struct{})
+			handler = metrics.NewPrometheusHandler(logger,
+				metrics.MetricSource{
+					Name:    "slowSource",
+					Timeout: 10 * time.Millisecond,
+					Getter: func() (float64, error) {
+						<-release
+						return 1, nil
+					},
+				},
+				metrics.MetricSource{
+					Name:   "fastSource",
+					Getter: func() (float64, error) { return 2, nil },
+				},
+			)
+		})
+
+		AfterEach(func() {
+			close(release)
+		})
+
+		It("logs the timeout and serves the other metrics", func() {
+			_, body := scrape()
+			Expect(body).To(Equal(`# TYPE fastSource gauge
+fastSource 2
+`))
+			Expect(logger).To(gbytes.Say("metric-getter-timeout.*slowSource"))
+		})
+	})
+
+	Context("when used as the sink of a MetricsSender", func() {
+		It("records everything sent", func() {
+			handler = metrics.NewPrometheusHandler(logger)
+			sender := metrics.NewMetricsSender(logger, handler)
+			sender.SendDuration("requestTime", 2*time.Second)
+			sender.IncrementCounter("requestCount")
+
+			_, body := scrape()
+			Expect(body).To(ContainSubstring("requestTime_seconds 2\n"))
+			Expect(body).To(ContainSubstring("requestCount_total 1\n"))
+		})
+	})
+})
+
+var _ = Describe("PrometheusServer", func() {
+	var (
+		address string
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		address = fmt.Sprintf("127.0.0.1:%d", ports.PickAPort())
+		handler := metrics.NewPrometheusHandler(lagertest.NewTestLogger("test"), metrics.MetricSource{
+			Name:   "uptime",
+			Unit:   "seconds",
+			Getter: func() (float64, error) { return 42, nil },
+		})
+		process = ifrit.Invoke(metrics.NewPrometheusServer(address, handler, lagertest.NewTestLogger("test")))
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+	})
+
+	It("serves the handler on /metrics", func() {
+		resp, err := http.Get(fmt.Sprintf("http://%s/metrics", address))
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		body, err := ioutil.ReadAll(resp.Body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(body)).To(ContainSubstring("uptime_seconds 42\n"))
+	})
+})
@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+type RecordedKind string
+
+const (
+	RecordedValue    RecordedKind = "value"
+	RecordedCounter  RecordedKind = "counter"
+	RecordedDuration RecordedKind = "duration"
+)
+
+// RecordedCall is one call made to a RecordingSender. Value is the value
+// sent, what was added to a counter, or the duration in ms.
+type RecordedCall struct {
+	Kind     RecordedKind
+	Name     string
+	Value    float64
+	Unit     string
+	Duration time.Duration
+	Tags     map[string]string
+	Time     time.Time
+}
+
+// RecordingSender has the methods of MetricsSender and keeps every call, for
+// tests. Its queries match calls by name, or by name and tags flattened as
+// by FlattenTags, e.g. "requests;method=GET".
+type RecordingSender struct {
+	lock  sync.Mutex
+	calls []RecordedCall
+}
+
+func NewRecordingSender() *RecordingSender {
+	return &RecordingSender{}
+}
+
+func (s *RecordingSender) SendDuration(name string, duration time.Duration) {
+	s.SendDurationWithTags(name, duration, nil)
+}
+
+func (s *RecordingSender) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) {
+	s.record(RecordedCall{Kind: RecordedDuration, Name: name, Value: durationMillis(duration), Unit: "ms", Duration: duration, Tags: tags})
+}
+
+func (s *RecordingSender) SendValue(name string, value float64, units string) {
+	s.SendValueWithTags(name, value, units, nil)
+}
+
+func (s *RecordingSender) SendValueWithTags(name string, value float64, units string, tags map[string]string) {
+	s.record(RecordedCall{Kind: RecordedValue, Name: name, Value: value, Unit: units, Tags: tags})
+}
+
+func (s *RecordingSender) IncrementCounter(name string) {
+	s.IncrementCounterWithTags(name, nil)
+}
+
+func (s *RecordingSender) IncrementCounterWithTags(name string, tags map[string]string) {
+	s.AddToCounterWithTags(name, 1, tags)
+}
+
+func (s *RecordingSender) AddToCounter(name string, delta uint64) {
+	s.AddToCounterWithTags(name, delta, nil)
+}
+
+func (s *RecordingSender) AddToCounterWithTags(name string, delta uint64, tags map[string]string) {
+	s.record(RecordedCall{Kind: RecordedCounter, Name: name, Value: float64(delta), Tags: tags})
+}
+
+func (s *RecordingSender) SendErrors() uint64 {
+	return 0
+}
+
+// Calls returns every call in the order they were made.
+func (s *RecordingSender) Calls() []RecordedCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]RecordedCall{}, s.calls...)
+}
+
+// LastValue returns the last value sent for name.
+func (s *RecordingSender) LastValue(name string) (float64, bool) {
+	calls := s.matching(RecordedValue, name)
+	if len(calls) == 0 {
+		return 0, false
+	}
+	return calls[len(calls)-1].Value, true
+}
+
+func (s *RecordingSender) Values(name string) []float64 {
+	values := []float64{}
+	for _, call := range s.matching(RecordedValue, name) {
+		values = append(values, call.Value)
+	}
+	return values
+}
+
+// CounterCount returns the total added to the counter name.
+func (s *RecordingSender) CounterCount(name string) int {
+	count := 0
+	for _, call := range s.matching(RecordedCounter, name) {
+		count += int(call.Value)
+	}
+	return count
+}
+
+func (s *RecordingSender) Durations(name string) []time.Duration {
+	durations := []time.Duration{}
+	for _, call := range s.matching(RecordedDuration, name) {
+		durations = append(durations, call.Duration)
+	}
+	return durations
+}
+
+func (s *RecordingSender) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls = nil
+}
+
+func (s *RecordingSender) record(call RecordedCall) {
+	call.Time = time.Now()
+	// Callers may reuse their tags map, so keep a copy of it.
+	if call.Tags != nil {
+		call.Tags = MergeTags(call.Tags)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.calls = append(s.calls, call)
+}
+
+func (s *RecordingSender) matching(kind RecordedKind, name string) []RecordedCall {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	var calls []RecordedCall
+	for _, call := range s.calls {
+		if call.Kind != kind {
+			continue
+		}
+		if call.Name == name || (len(call.Tags) > 0 && FlattenTags(call.Name, call.Tags) == name) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
@@ -0,0 +1,116 @@
+package metrics_test
+
+import (
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type sender interface {
+	SendDuration(string, time.Duration)
+	SendDurationWithTags(string, time.Duration, map[string]string)
+	SendValue(string, float64, string)
+	SendValueWithTags(string, float64, string, map[string]string)
+	IncrementCounter(string)
+	IncrementCounterWithTags(string, map[string]string)
+	SendErrors() uint64
+}
+
+var (
+	_ sender = &metrics.MetricsSender{}
+	_ sender = &metrics.NoOpMetricsSender{}
+	_ sender = &metrics.RecordingSender{}
+)
+
+var _ = Describe("RecordingSender", func() {
+	var recorder *metrics.RecordingSender
+
+	BeforeEach(func() {
+		recorder = metrics.NewRecordingSender()
+	})
+
+	It("keeps every call with a timestamp", func() {
+		before := time.Now()
+		recorder.SendValue("queueDepth", 3, "count")
+		recorder.IncrementCounterWithTags("requests", map[string]string{"method": "GET"})
+		recorder.SendDuration("requestTime", 2*time.Millisecond)
+
+		calls := recorder.Calls()
+		Expect(calls).To(HaveLen(3))
+		Expect(calls[0]).To(matchCall("value", "queueDepth", 3.0, "count"))
+		Expect(calls[1]).To(matchCall("counter", "requests", 1.0, ""))
+		Expect(calls[1].Tags).To(Equal(map[string]string{"method": "GET"}))
+		Expect(calls[2]).To(matchCall("duration", "requestTime", 2.0, "ms"))
+		Expect(calls[2].Duration).To(Equal(2 * time.Millisecond))
+		for _, call := range calls {
+			Expect(call.Time).To(BeTemporally(">=", before))
+		}
+	})
+
+	It("answers queries by name or by name and tags", func() {
+		recorder.SendValue("queueDepth", 3, "")
+		recorder.SendValueWithTags("queueDepth", 5, "", map[string]string{"queue": "a"})
+		recorder.IncrementCounter("requests")
+		recorder.IncrementCounterWithTags("requests", map[string]string{"method": "GET"})
+		recorder.SendDuration("requestTime", time.Second)
+
+		value, ok := recorder.LastValue("queueDepth")
+		Expect(ok).To(BeTrue())
+		Expect(value).To(Equal(5.0))
+		Expect(recorder.Values("queueDepth")).To(Equal([]float64{3, 5}))
+		Expect(recorder.Values("queueDepth;queue=a")).To(Equal([]float64{5}))
+
+		Expect(recorder.CounterCount("requests")).To(Equal(2))
+		Expect(recorder.CounterCount("requests;method=GET")).To(Equal(1))
+		recorder.AddToCounter("requests", 3)
+		Expect(recorder.CounterCount("requests")).To(Equal(5))
+		Expect(recorder.Durations("requestTime")).To(Equal([]time.Duration{time.Second}))
+
+		_, ok = recorder.LastValue("missing")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("keeps the tags as they were when sent", func() {
+		tags := map[string]string{"method": "GET"}
+		recorder.SendValueWithTags("queueDepth", 5, "", tags)
+		recorder.SendDurationWithTags("requestTime", time.Second, tags)
+		recorder.IncrementCounterWithTags("requests", tags)
+		tags["method"] = "POST"
+
+		for _, call := range recorder.Calls() {
+			Expect(call.Tags).To(Equal(map[string]string{"method": "GET"}))
+		}
+		Expect(recorder.CounterCount("requests;method=GET")).To(Equal(1))
+	})
+
+	It("forgets everything on reset", func() {
+		recorder.IncrementCounter("requests")
+		recorder.Reset()
+		Expect(recorder.Calls()).To(BeEmpty())
+		Expect(recorder.CounterCount("requests")).To(Equal(0))
+	})
+
+	It("is safe for concurrent use", func() {
+		wg := sync.WaitGroup{}
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				recorder.IncrementCounter("requests")
+				recorder.CounterCount("requests")
+			}()
+		}
+		wg.Wait()
+		Expect(recorder.CounterCount("requests")).To(Equal(10))
+	})
+})
+
+func matchCall(kind, name string, value float64, unit string) OmegaMatcher {
+	return WithTransform(func(call metrics.RecordedCall) []interface{} {
+		return []interface{}{string(call.Kind), call.Name, call.Value, call.Unit}
+	}, Equal([]interface{}{kind, name, value, unit}))
+}
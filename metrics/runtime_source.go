@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// NewRuntimeSources reports the Go runtime's goroutine count, heap in use
+// and garbage collections. GC pause percentiles cover the last 256
+// collections.
+func NewRuntimeSources() []MetricSource {
+	return []MetricSource{
+		{
+			Name: "goroutines",
+			Unit: "",
+			Getter: func() (float64, error) {
+				return float64(runtime.NumGoroutine()), nil
+			},
+		},
+		{
+			Name: "heapInUse",
+			Unit: "bytes",
+			Getter: func() (float64, error) {
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				return float64(stats.HeapInuse), nil
+			},
+		},
+		{
+			Name: "gcCount",
+			Unit: "",
+			Getter: func() (float64, error) {
+				var stats runtime.MemStats
+				runtime.ReadMemStats(&stats)
+				return float64(stats.NumGC), nil
+			},
+		},
+		gcPauseSource("gcPauseP50", 50),
+		gcPauseSource("gcPauseP95", 95),
+		gcPauseSource("gcPauseP99", 99),
+	}
+}
+
+func gcPauseSource(name string, percentile int) MetricSource {
+	return MetricSource{
+		Name: name,
+		Unit: "ms",
+		Getter: func() (float64, error) {
+			// 101 quantiles are the 0th to the 100th percentile.
+			stats := debug.GCStats{PauseQuantiles: make([]time.Duration, 101)}
+			debug.ReadGCStats(&stats)
+			if stats.NumGC == 0 {
+				return 0, nil
+			}
+			return durationMillis(stats.PauseQuantiles[percentile]), nil
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package metrics_test
+
+import (
+	"runtime"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RuntimeSources", func() {
+	var sources map[string]metrics.MetricSource
+
+	BeforeEach(func() {
+		sources = map[string]metrics.MetricSource{}
+		for _, source := range metrics.NewRuntimeSources() {
+			sources[source.Name] = source
+		}
+	})
+
+	value := func(name string) float64 {
+		source, ok := sources[name]
+		Expect(ok).To(BeTrue(), name)
+		value, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return value
+	}
+
+	It("reports goroutines and heap in use", func() {
+		Expect(value("goroutines")).To(BeNumerically(">", 0))
+		Expect(value("heapInUse")).To(BeNumerically(">", 0))
+		Expect(sources["heapInUse"].Unit).To(Equal("bytes"))
+	})
+
+	It("reports garbage collections and their pause percentiles", func() {
+		before := value("gcCount")
+		runtime.GC()
+		Expect(value("gcCount")).To(BeNumerically(">", before))
+
+		p50, p95, p99 := value("gcPauseP50"), value("gcPauseP95"), value("gcPauseP99")
+		Expect(p50).To(BeNumerically(">", 0))
+		Expect(p95).To(BeNumerically(">=", p50))
+		Expect(p99).To(BeNumerically(">=", p95))
+		Expect(sources["gcPauseP99"].Unit).To(Equal("ms"))
+	})
+})
@@ -0,0 +1,70 @@
+package metrics
+
+type dropper interface {
+	Dropped() uint64
+}
+
+// NewSelfSources report how well metrics are delivered: the send errors of
+// sender and emitter, how long the emitter's last round took, and how many
+// metrics were dropped by sinks that buffer, such as LoggregatorSink and
+// OTLPExporter. Getter errors and timeouts are already counted by the
+// emitter. sender and emitter may be nil.
+func NewSelfSources(sender *MetricsSender, emitter *MetricsEmitter, sinks ...Sink) []MetricSource {
+	var droppers []dropper
+	for _, sink := range sinks {
+		droppers = appendDroppers(droppers, sink)
+	}
+
+	sources := []MetricSource{
+		{
+			Name: "metricsSendErrors",
+			Unit: "",
+			Getter: func() (float64, error) {
+				var total uint64
+				if sender != nil {
+					total += sender.SendErrors()
+				}
+				if emitter != nil {
+					total += emitter.Stats().SendErrors
+				}
+				return float64(total), nil
+			},
+		},
+		{
+			Name: "metricsDropped",
+			Unit: "",
+			Getter: func() (float64, error) {
+				var total uint64
+				for _, d := range droppers {
+					total += d.Dropped()
+				}
+				return float64(total), nil
+			},
+		},
+	}
+
+	if emitter != nil {
+		sources = append(sources, MetricSource{
+			Name: "metricsEmitDuration",
+			Unit: "ms",
+			Getter: func() (float64, error) {
+				return durationMillis(emitter.Stats().EmitDuration), nil
+			},
+		})
+	}
+	return sources
+}
+
+func appendDroppers(droppers []dropper, sink Sink) []dropper {
+	switch s := sink.(type) {
+	case FanOutSink:
+		for _, child := range s {
+			droppers = appendDroppers(droppers, child)
+		}
+	case *StaticTagsSink:
+		droppers = appendDroppers(droppers, s.Sink)
+	case dropper:
+		droppers = append(droppers, s)
+	}
+	return droppers
+}
@@ -0,0 +1,72 @@
+package metrics_test
+
+import (
+	"errors"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SelfSources", func() {
+	var (
+		sink    *fakes.MetricsSink
+		sender  *metrics.MetricsSender
+		emitter *metrics.MetricsEmitter
+		sources map[string]metrics.MetricSource
+	)
+
+	value := func(name string) float64 {
+		source, ok := sources[name]
+		Expect(ok).To(BeTrue(), "missing source %s", name)
+		v, err := source.Getter()
+		Expect(err).NotTo(HaveOccurred())
+		return v
+	}
+
+	BeforeEach(func() {
+		logger := lagertest.NewTestLogger("test")
+		sink = &fakes.MetricsSink{}
+		sender = metrics.NewMetricsSender(logger, sink)
+		emitter = metrics.NewMetricsEmitterWithSink(logger, time.Hour, sink, metrics.MetricSource{
+			Name:   "someSource",
+			Getter: func() (float64, error) { return 1, nil },
+		})
+
+		sources = map[string]metrics.MetricSource{}
+		for _, source := range metrics.NewSelfSources(sender, emitter, metrics.NewFanOutSink(sink, droppingSink{dropped: 4})) {
+			sources[source.Name] = source
+		}
+	})
+
+	It("reports the send errors of the sender and the emitter", func() {
+		sink.SendGaugeReturns(errors.New("potato"))
+		sender.SendValue("a", 1, "")
+		emitter.EmitMetrics()
+
+		Expect(value("metricsSendErrors")).To(Equal(2.0))
+	})
+
+	It("reports what buffering sinks dropped", func() {
+		Expect(value("metricsDropped")).To(Equal(4.0))
+	})
+
+	It("reports how long the last emit took", func() {
+		emitter.EmitMetrics()
+		Expect(sources["metricsEmitDuration"].Unit).To(Equal("ms"))
+		Expect(value("metricsEmitDuration")).To(BeNumerically(">", 0))
+	})
+})
+
+type droppingSink struct {
+	metrics.NoOpSink
+	dropped uint64
+}
+
+func (d droppingSink) Dropped() uint64 {
+	return d.dropped
+}
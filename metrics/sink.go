@@ -0,0 +1,160 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	dropsondemetrics "github.com/cloudfoundry/dropsonde/metrics"
+)
+
+//go:generate counterfeiter -o ../fakes/metrics_sink.go --fake-name MetricsSink . Sink
+type Sink interface {
+	SendGauge(name string, value float64, unit string) error
+	AddToCounter(name string, delta uint64) error
+	SendDuration(name string, duration time.Duration) error
+}
+
+// DropsondeSink sends through the global dropsonde metric sender.
+type DropsondeSink struct{}
+
+func (DropsondeSink) SendGauge(name string, value float64, unit string) error {
+	return dropsondemetrics.SendValue(name, value, unit)
+}
+
+func (DropsondeSink) AddToCounter(name string, delta uint64) error {
+	return dropsondemetrics.AddToCounter(name, delta)
+}
+
+func (DropsondeSink) SendDuration(name string, duration time.Duration) error {
+	return dropsondemetrics.SendValue(name, durationMillis(duration), "ms")
+}
+
+type NoOpSink struct{}
+
+func (NoOpSink) SendGauge(string, float64, string) error {
+	return nil
+}
+
+func (NoOpSink) AddToCounter(string, uint64) error {
+	return nil
+}
+
+func (NoOpSink) SendDuration(string, time.Duration) error {
+	return nil
+}
+
+// FanOutSink sends every metric to all of its sinks, even if some fail. Tags
+// are flattened only for the sinks that do not support them.
+type FanOutSink []Sink
+
+func NewFanOutSink(sinks ...Sink) FanOutSink {
+	return FanOutSink(sinks)
+}
+
+func (f FanOutSink) SendGauge(name string, value float64, unit string) error {
+	return f.each(func(s Sink) error { return s.SendGauge(name, value, unit) })
+}
+
+func (f FanOutSink) AddToCounter(name string, delta uint64) error {
+	return f.each(func(s Sink) error { return s.AddToCounter(name, delta) })
+}
+
+func (f FanOutSink) SendDuration(name string, duration time.Duration) error {
+	return f.each(func(s Sink) error { return s.SendDuration(name, duration) })
+}
+
+func (f FanOutSink) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	return f.each(func(s Sink) error { return sendGauge(s, name, value, unit, tags) })
+}
+
+func (f FanOutSink) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	return f.each(func(s Sink) error { return addToCounter(s, name, delta, tags) })
+}
+
+func (f FanOutSink) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	return f.each(func(s Sink) error { return sendDuration(s, name, duration, tags) })
+}
+
+func (f FanOutSink) each(send func(Sink) error) error {
+	var errs []string
+	for _, sink := range f {
+		if err := send(sink); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// InMemorySink keeps everything sent to it, for tests.
+type InMemorySink struct {
+	lock      sync.Mutex
+	gauges    map[string]Gauge
+	counters  map[string]uint64
+	durations map[string][]time.Duration
+}
+
+type Gauge struct {
+	Value float64 `json:"value"`
+	Unit  string  `json:"unit"`
+}
+
+func NewInMemorySink() *InMemorySink {
+	s := &InMemorySink{}
+	s.Reset()
+	return s
+}
+
+func (s *InMemorySink) SendGauge(name string, value float64, unit string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.gauges[name] = Gauge{Value: value, Unit: unit}
+	return nil
+}
+
+func (s *InMemorySink) AddToCounter(name string, delta uint64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.counters[name] += delta
+	return nil
+}
+
+func (s *InMemorySink) SendDuration(name string, duration time.Duration) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.durations[name] = append(s.durations[name], duration)
+	return nil
+}
+
+// Gauge returns the last value sent for name.
+func (s *InMemorySink) Gauge(name string) (Gauge, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	gauge, ok := s.gauges[name]
+	return gauge, ok
+}
+
+// Counter returns the total of all deltas added to name.
+func (s *InMemorySink) Counter(name string) uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.counters[name]
+}
+
+func (s *InMemorySink) Durations(name string) []time.Duration {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]time.Duration{}, s.durations[name]...)
+}
+
+func (s *InMemorySink) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.gauges = map[string]Gauge{}
+	s.counters = map[string]uint64{}
+	s.durations = map[string][]time.Duration{}
+}
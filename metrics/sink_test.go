@@ -0,0 +1,124 @@
+package metrics_test
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Sinks", func() {
+	Describe("InMemorySink", func() {
+		var sink *metrics.InMemorySink
+
+		BeforeEach(func() {
+			sink = metrics.NewInMemorySink()
+		})
+
+		It("keeps the last gauge, the counter totals and every duration", func() {
+			Expect(sink.SendGauge("gauge", 1, "ms")).To(Succeed())
+			Expect(sink.SendGauge("gauge", 2, "ms")).To(Succeed())
+			Expect(sink.AddToCounter("counter", 2)).To(Succeed())
+			Expect(sink.AddToCounter("counter", 3)).To(Succeed())
+			Expect(sink.SendDuration("duration", time.Second)).To(Succeed())
+			Expect(sink.SendDuration("duration", time.Minute)).To(Succeed())
+
+			gauge, ok := sink.Gauge("gauge")
+			Expect(ok).To(BeTrue())
+			Expect(gauge).To(Equal(metrics.Gauge{Value: 2, Unit: "ms"}))
+			Expect(sink.Counter("counter")).To(Equal(uint64(5)))
+			Expect(sink.Durations("duration")).To(Equal([]time.Duration{time.Second, time.Minute}))
+
+			sink.Reset()
+			_, ok = sink.Gauge("gauge")
+			Expect(ok).To(BeFalse())
+			Expect(sink.Counter("counter")).To(BeZero())
+			Expect(sink.Durations("duration")).To(BeEmpty())
+		})
+	})
+
+	Describe("FanOutSink", func() {
+		var (
+			failing *fakes.MetricsSink
+			memory  *metrics.InMemorySink
+			sink    metrics.FanOutSink
+		)
+
+		BeforeEach(func() {
+			failing = &fakes.MetricsSink{}
+			failing.SendGaugeReturns(errors.New("banana"))
+			failing.AddToCounterReturns(errors.New("banana"))
+			failing.SendDurationReturns(errors.New("banana"))
+			memory = metrics.NewInMemorySink()
+			sink = metrics.NewFanOutSink(failing, memory)
+		})
+
+		It("sends to every sink and returns their errors", func() {
+			Expect(sink.SendGauge("gauge", 1, "")).To(MatchError("banana"))
+			Expect(sink.AddToCounter("counter", 1)).To(MatchError("banana"))
+			Expect(sink.SendDuration("duration", time.Second)).To(MatchError("banana"))
+
+			Expect(failing.SendGaugeCallCount()).To(Equal(1))
+			Expect(failing.AddToCounterCallCount()).To(Equal(1))
+			Expect(failing.SendDurationCallCount()).To(Equal(1))
+
+			_, ok := memory.Gauge("gauge")
+			Expect(ok).To(BeTrue())
+			Expect(memory.Counter("counter")).To(Equal(uint64(1)))
+			Expect(memory.Durations("duration")).To(HaveLen(1))
+		})
+	})
+
+	Context("when given to a MetricsSender", func() {
+		It("sends everything to the sink instead of dropsonde", func() {
+			fakeDropsonde.Reset()
+			sink := metrics.NewInMemorySink()
+			sender := metrics.NewMetricsSender(lagertest.NewTestLogger("test"), sink)
+
+			sender.SendValue("value", 4, "unit")
+			sender.SendDuration("duration", time.Second)
+			sender.IncrementCounter("counter")
+
+			gauge, ok := sink.Gauge("value")
+			Expect(ok).To(BeTrue())
+			Expect(gauge).To(Equal(metrics.Gauge{Value: 4, Unit: "unit"}))
+			Expect(sink.Durations("duration")).To(Equal([]time.Duration{time.Second}))
+			Expect(sink.Counter("counter")).To(Equal(uint64(1)))
+			Expect(fakeDropsonde.GetMessages()).To(BeEmpty())
+		})
+	})
+
+	Context("when given to a MetricsEmitter", func() {
+		It("sends each source to the sink and logs failures", func() {
+			logger := lagertest.NewTestLogger("test")
+			sink := &fakes.MetricsSink{}
+			sink.SendGaugeReturns(errors.New("banana"))
+
+			emitter := metrics.NewMetricsEmitterWithSink(logger, time.Hour, sink, metrics.MetricSource{
+				Name:   "source",
+				Unit:   "unit",
+				Getter: func() (float64, error) { return 42, nil },
+			})
+			process := ifrit.Invoke(emitter)
+			defer func() {
+				process.Signal(os.Interrupt)
+				Eventually(process.Wait()).Should(Receive())
+			}()
+
+			Expect(sink.SendGaugeCallCount()).To(Equal(1))
+			name, value, unit := sink.SendGaugeArgsForCall(0)
+			Expect(name).To(Equal("source"))
+			Expect(value).To(Equal(42.0))
+			Expect(unit).To(Equal("unit"))
+			Expect(logger).To(gbytes.Say("sending-metric.*banana.*source"))
+		})
+	})
+})
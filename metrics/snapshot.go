@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/clock"
+	"code.cloudfoundry.org/lager"
+)
+
+const DefaultSnapshotTimeout = 10 * time.Second
+
+type SnapshotConfig struct {
+	// Path, if set, is the file the snapshot is written to.
+	Path string
+	// URL, if set, is where the snapshot is POSTed.
+	URL     string
+	Timeout time.Duration
+}
+
+// Snapshot holds the source values and what was sent to a SnapshotWriter.
+// Tagged metrics are keyed by their name flattened with FlattenTags.
+type Snapshot struct {
+	Time        time.Time            `json:"time"`
+	Gauges      map[string]Gauge     `json:"gauges"`
+	Counters    map[string]uint64    `json:"counters"`
+	DurationsMS map[string][]float64 `json:"durations_ms"`
+	// Errors has the error of each source whose getter failed or timed out.
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// SnapshotWriter is a Sink that records everything sent to it and, when
+// signalled, writes a JSON Snapshot of it and its sources' current values.
+// Getters are waited for up to their Timeout, or DefaultGetterTimeout.
+// It is meant for errands and one-shot tools that exit before a
+// MetricsEmitter interval is up.
+type SnapshotWriter struct {
+	*InMemorySink
+
+	config  SnapshotConfig
+	logger  lager.Logger
+	sources []MetricSource
+	client  *http.Client
+}
+
+func NewSnapshotWriter(logger lager.Logger, config SnapshotConfig, sources ...MetricSource) *SnapshotWriter {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultSnapshotTimeout
+	}
+
+	return &SnapshotWriter{
+		InMemorySink: NewInMemorySink(),
+		config:       config,
+		logger:       logger,
+		sources:      sources,
+		client:       &http.Client{},
+	}
+}
+
+func (w *SnapshotWriter) Snapshot() Snapshot {
+	snapshot := Snapshot{
+		Time:        time.Now(),
+		Gauges:      map[string]Gauge{},
+		Counters:    map[string]uint64{},
+		DurationsMS: map[string][]float64{},
+	}
+
+	w.lock.Lock()
+	for name, gauge := range w.gauges {
+		snapshot.Gauges[name] = gauge
+	}
+	for name, total := range w.counters {
+		snapshot.Counters[name] = total
+	}
+	for name, durations := range w.durations {
+		for _, duration := range durations {
+			snapshot.DurationsMS[name] = append(snapshot.DurationsMS[name], durationMillis(duration))
+		}
+	}
+	w.lock.Unlock()
+
+	results := getValues(clock.NewClock(), w.sources, DefaultGetterTimeout)
+	for i, source := range w.sources {
+		name := FlattenTags(source.Name, source.Tags)
+		if err := results[i].err; err != nil {
+			if snapshot.Errors == nil {
+				snapshot.Errors = map[string]string{}
+			}
+			snapshot.Errors[name] = err.Error()
+			continue
+		}
+		snapshot.Gauges[name] = Gauge{Value: results[i].value, Unit: source.Unit}
+	}
+	return snapshot
+}
+
+// Write takes a snapshot and writes it to the configured file and URL.
+func (w *SnapshotWriter) Write() error {
+	payload, err := json.Marshal(w.Snapshot())
+	if err != nil {
+		return fmt.Errorf("marshal snapshot: %s", err)
+	}
+
+	if w.config.Path != "" {
+		if err := writeFileAtomically(w.config.Path, payload); err != nil {
+			return fmt.Errorf("write snapshot: %s", err)
+		}
+	}
+
+	if w.config.URL != "" {
+		if err := w.post(payload); err != nil {
+			return fmt.Errorf("post snapshot: %s", err)
+		}
+	}
+	return nil
+}
+
+func (w *SnapshotWriter) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	close(ready)
+	<-signals
+
+	err := w.Write()
+	if err != nil {
+		w.logger.Error("writing-metrics-snapshot", err)
+	}
+	return err
+}
+
+func (w *SnapshotWriter) post(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.Timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, "POST", w.config.URL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// writeFileAtomically makes sure readers never see a partial snapshot.
+func writeFileAtomically(path string, contents []byte) error {
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
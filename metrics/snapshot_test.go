@@ -0,0 +1,138 @@
+package metrics_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("SnapshotWriter", func() {
+	var (
+		logger  *lagertest.TestLogger
+		dir     string
+		sources []metrics.MetricSource
+	)
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+
+		var err error
+		dir, err = ioutil.TempDir("", "snapshot")
+		Expect(err).NotTo(HaveOccurred())
+
+		sources = []metrics.MetricSource{
+			{
+				Name:   "policiesCreated",
+				Unit:   "count",
+				Tags:   map[string]string{"space": "a"},
+				Getter: func() (float64, error) { return 3, nil },
+			},
+			{
+				Name:   "badSource",
+				Getter: func() (float64, error) { return 0, errors.New("potato") },
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	readSnapshot := func(path string) metrics.Snapshot {
+		contents, err := ioutil.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		var snapshot metrics.Snapshot
+		Expect(json.Unmarshal(contents, &snapshot)).To(Succeed())
+		return snapshot
+	}
+
+	It("writes the source values and what was sent to it when signalled", func() {
+		path := filepath.Join(dir, "metrics.json")
+		writer := metrics.NewSnapshotWriter(logger, metrics.SnapshotConfig{Path: path}, sources...)
+		sender := metrics.NewMetricsSender(logger, writer)
+		process := ifrit.Invoke(writer)
+
+		sender.IncrementCounter("requests")
+		sender.IncrementCounterWithTags("requests", map[string]string{"status": "500"})
+		sender.SendValue("queueDepth", 2, "")
+		sender.SendDuration("errandTime", 1500*time.Millisecond)
+		Expect(path).NotTo(BeAnExistingFile())
+
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive(BeNil()))
+
+		snapshot := readSnapshot(path)
+		Expect(snapshot.Time).To(BeTemporally("~", time.Now(), time.Minute))
+		Expect(snapshot.Gauges).To(Equal(map[string]metrics.Gauge{
+			"policiesCreated;space=a": {Value: 3, Unit: "count"},
+			"queueDepth":              {Value: 2, Unit: ""},
+		}))
+		Expect(snapshot.Counters).To(Equal(map[string]uint64{"requests": 1, "requests;status=500": 1}))
+		Expect(snapshot.DurationsMS).To(Equal(map[string][]float64{"errandTime": {1500}}))
+		Expect(snapshot.Errors).To(Equal(map[string]string{"badSource": "potato"}))
+	})
+
+	It("records getters that do not return in time as errors", func() {
+		release := make(chan struct{})
+		defer close(release)
+		writer := metrics.NewSnapshotWriter(logger, metrics.SnapshotConfig{}, metrics.MetricSource{
+			Name:    "slowSource",
+			Timeout: 10 * time.Millisecond,
+			Getter: func() (float64, error) {
+				<-release
+				return 1, nil
+			},
+		})
+
+		snapshot := writer.Snapshot()
+		Expect(snapshot.Gauges).To(BeEmpty())
+		Expect(snapshot.Errors).To(Equal(map[string]string{"slowSource": "timed out after 10ms"}))
+	})
+
+	It("posts the snapshot", func() {
+		received := make(chan metrics.Snapshot, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			defer GinkgoRecover()
+			Expect(req.Method).To(Equal("POST"))
+			Expect(req.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			var snapshot metrics.Snapshot
+			Expect(json.NewDecoder(req.Body).Decode(&snapshot)).To(Succeed())
+			received <- snapshot
+		}))
+		defer server.Close()
+
+		writer := metrics.NewSnapshotWriter(logger, metrics.SnapshotConfig{URL: server.URL}, sources...)
+		Expect(writer.Write()).To(Succeed())
+
+		var snapshot metrics.Snapshot
+		Eventually(received).Should(Receive(&snapshot))
+		Expect(snapshot.Gauges).To(HaveKey("policiesCreated;space=a"))
+	})
+
+	It("fails and logs when the snapshot cannot be written", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		writer := metrics.NewSnapshotWriter(logger, metrics.SnapshotConfig{URL: server.URL})
+		process := ifrit.Invoke(writer)
+		process.Signal(os.Interrupt)
+
+		Eventually(process.Wait()).Should(Receive(MatchError("post snapshot: unexpected status 502")))
+		Expect(logger.LogMessages()).To(ContainElement("test.writing-metrics-snapshot"))
+	})
+})
@@ -0,0 +1,221 @@
+package metrics
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/lager"
+)
+
+const (
+	// DefaultStatsdMaxPacketSize keeps packets within an Ethernet MTU.
+	DefaultStatsdMaxPacketSize = 1432
+	DefaultStatsdFlushInterval = time.Second
+)
+
+var (
+	statsdNameEscaper   = newStatsdEscaper(":|@\n")
+	dogStatsdTagEscaper = newStatsdEscaper(",|#\n")
+)
+
+type StatsdConfig struct {
+	Address string
+	Prefix  string
+	// DogStatsD sends tags with the DogStatsD "|#key:value" extension.
+	// Without it tags are flattened into the name.
+	DogStatsD bool
+	// SampleRate between 0 and 1 sends only that share of counters and
+	// timers. It defaults to 1.
+	SampleRate    float64
+	MaxPacketSize int
+	FlushInterval time.Duration
+}
+
+func (c StatsdConfig) WithDefaults() StatsdConfig {
+	if c.SampleRate <= 0 || c.SampleRate > 1 {
+		c.SampleRate = 1
+	}
+	if c.MaxPacketSize <= 0 {
+		c.MaxPacketSize = DefaultStatsdMaxPacketSize
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = DefaultStatsdFlushInterval
+	}
+	return c
+}
+
+// StatsdSink sends metrics to a StatsD server over UDP. Lines are coalesced
+// into packets of up to MaxPacketSize bytes, which are sent when full and by
+// Run every FlushInterval.
+type StatsdSink struct {
+	config StatsdConfig
+	logger lager.Logger
+	conn   net.Conn
+
+	lock   sync.Mutex
+	buffer []byte
+}
+
+func NewStatsdSink(config StatsdConfig, logger lager.Logger) (*StatsdSink, error) {
+	config = config.WithDefaults()
+
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd dial: %s", err)
+	}
+
+	return &StatsdSink{
+		config: config,
+		logger: logger,
+		conn:   conn,
+		buffer: make([]byte, 0, config.MaxPacketSize),
+	}, nil
+}
+
+func (s *StatsdSink) SendGauge(name string, value float64, unit string) error {
+	return s.SendGaugeWithTags(name, value, unit, nil)
+}
+
+func (s *StatsdSink) AddToCounter(name string, delta uint64) error {
+	return s.AddToCounterWithTags(name, delta, nil)
+}
+
+func (s *StatsdSink) SendDuration(name string, duration time.Duration) error {
+	return s.SendDurationWithTags(name, duration, nil)
+}
+
+// SendGaugeWithTags sets a negative gauge to 0 first, in the same packet, as
+// StatsD takes a leading sign as a change to the current value.
+func (s *StatsdSink) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	line := s.line(name, strconv.FormatFloat(value, 'f', -1, 64), "g", 1, tags)
+	if value < 0 {
+		line = s.line(name, "0", "g", 1, tags) + "\n" + line
+	}
+	return s.writeLine(line)
+}
+
+func (s *StatsdSink) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	if !s.sampled() {
+		return nil
+	}
+	return s.write(name, strconv.FormatUint(delta, 10), "c", s.config.SampleRate, tags)
+}
+
+func (s *StatsdSink) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	if !s.sampled() {
+		return nil
+	}
+	return s.write(name, strconv.FormatFloat(durationMillis(duration), 'f', -1, 64), "ms", s.config.SampleRate, tags)
+}
+
+func (s *StatsdSink) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	close(ready)
+
+	for {
+		select {
+		case <-signals:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("statsd-final-flush", err)
+			}
+			return s.conn.Close()
+		case <-ticker.C:
+			if err := s.Flush(); err != nil {
+				s.logger.Error("statsd-send", err)
+			}
+		}
+	}
+}
+
+// Flush sends the lines buffered so far.
+func (s *StatsdSink) Flush() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.flushLocked()
+}
+
+func (s *StatsdSink) sampled() bool {
+	return s.config.SampleRate >= 1 || rand.Float64() < s.config.SampleRate
+}
+
+func (s *StatsdSink) write(name, value, metricType string, sampleRate float64, tags map[string]string) error {
+	return s.writeLine(s.line(name, value, metricType, sampleRate, tags))
+}
+
+func (s *StatsdSink) writeLine(line string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(s.buffer) > 0 && len(s.buffer)+1+len(line) > s.config.MaxPacketSize {
+		if err := s.flushLocked(); err != nil {
+			return err
+		}
+	}
+	if len(s.buffer) > 0 {
+		s.buffer = append(s.buffer, '\n')
+	}
+	s.buffer = append(s.buffer, line...)
+
+	if len(s.buffer) >= s.config.MaxPacketSize {
+		return s.flushLocked()
+	}
+	return nil
+}
+
+func (s *StatsdSink) flushLocked() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	_, err := s.conn.Write(s.buffer)
+	s.buffer = s.buffer[:0]
+	if err != nil {
+		return fmt.Errorf("statsd write: %s", err)
+	}
+	return nil
+}
+
+func (s *StatsdSink) line(name, value, metricType string, sampleRate float64, tags map[string]string) string {
+	if !s.config.DogStatsD && len(tags) > 0 {
+		name = FlattenTags(name, tags)
+	}
+
+	var b strings.Builder
+	b.WriteString(statsdNameEscaper.Replace(s.config.Prefix + name))
+	b.WriteString(":" + value + "|" + metricType)
+	if sampleRate < 1 {
+		b.WriteString("|@" + strconv.FormatFloat(sampleRate, 'f', -1, 64))
+	}
+
+	if s.config.DogStatsD && len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(dogStatsdTagEscaper.Replace(k) + ":" + dogStatsdTagEscaper.Replace(tags[k]))
+		}
+	}
+	return b.String()
+}
+
+func newStatsdEscaper(reserved string) *strings.Replacer {
+	var oldnew []string
+	for _, c := range reserved {
+		oldnew = append(oldnew, string(c), "_")
+	}
+	return strings.NewReplacer(oldnew...)
+}
@@ -0,0 +1,162 @@
+package metrics_test
+
+import (
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("StatsdSink", func() {
+	var (
+		server  net.PacketConn
+		packets chan string
+		config  metrics.StatsdConfig
+		sink    *metrics.StatsdSink
+		process ifrit.Process
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = net.ListenPacket("udp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+
+		packets = make(chan string, 1000)
+		go func() {
+			buffer := make([]byte, 65535)
+			for {
+				n, _, err := server.ReadFrom(buffer)
+				if err != nil {
+					return
+				}
+				packets <- string(buffer[:n])
+			}
+		}()
+
+		config = metrics.StatsdConfig{
+			Address:       server.LocalAddr().String(),
+			Prefix:        "policy-server.",
+			FlushInterval: time.Hour,
+		}
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		sink, err = metrics.NewStatsdSink(config, lagertest.NewTestLogger("test"))
+		Expect(err).NotTo(HaveOccurred())
+		process = ifrit.Invoke(sink)
+	})
+
+	AfterEach(func() {
+		process.Signal(os.Interrupt)
+		Eventually(process.Wait()).Should(Receive())
+		server.Close()
+	})
+
+	It("coalesces gauges, counters and timers into one packet", func() {
+		Expect(sink.SendGauge("queueDepth", 7.5, "count")).To(Succeed())
+		Expect(sink.AddToCounter("requests", 3)).To(Succeed())
+		Expect(sink.SendDuration("requestTime", 1500*time.Microsecond)).To(Succeed())
+		Consistently(packets, 100*time.Millisecond).ShouldNot(Receive())
+
+		Expect(sink.Flush()).To(Succeed())
+		Eventually(packets).Should(Receive(Equal(
+			"policy-server.queueDepth:7.5|g\n" +
+				"policy-server.requests:3|c\n" +
+				"policy-server.requestTime:1.5|ms",
+		)))
+	})
+
+	It("flattens tags into the name and escapes reserved characters", func() {
+		Expect(sink.AddToCounterWithTags("requests|total", 1, map[string]string{"status": "200", "method": "GET"})).To(Succeed())
+		Expect(sink.Flush()).To(Succeed())
+		Eventually(packets).Should(Receive(Equal("policy-server.requests_total;method=GET;status=200:1|c")))
+	})
+
+	It("sets negative gauges to 0 first, so they are not taken as a change", func() {
+		Expect(sink.SendGaugeWithTags("clockSkew", -2.5, "s", map[string]string{"az": "z1"})).To(Succeed())
+		Expect(sink.SendGauge("queueDepth", 0, "count")).To(Succeed())
+		Expect(sink.Flush()).To(Succeed())
+		Eventually(packets).Should(Receive(Equal(
+			"policy-server.clockSkew;az=z1:0|g\n" +
+				"policy-server.clockSkew;az=z1:-2.5|g\n" +
+				"policy-server.queueDepth:0|g",
+		)))
+	})
+
+	It("sends what is left when signalled", func() {
+		Expect(sink.AddToCounter("last", 1)).To(Succeed())
+		process.Signal(os.Interrupt)
+		Eventually(packets).Should(Receive(Equal("policy-server.last:1|c")))
+	})
+
+	Context("with the DogStatsD extension", func() {
+		BeforeEach(func() {
+			config.DogStatsD = true
+		})
+
+		It("sends the tags sorted by key", func() {
+			Expect(sink.SendGaugeWithTags("queueDepth", 1, "", map[string]string{"tenant": "a,b", "az": "z1"})).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+			Eventually(packets).Should(Receive(Equal("policy-server.queueDepth:1|g|#az:z1,tenant:a_b")))
+		})
+	})
+
+	Context("when the lines do not fit in one packet", func() {
+		BeforeEach(func() {
+			config.MaxPacketSize = 64
+		})
+
+		It("sends packets of up to MaxPacketSize bytes", func() {
+			for i := 0; i < 10; i++ {
+				Expect(sink.AddToCounter("requests", 1)).To(Succeed())
+			}
+			Expect(sink.Flush()).To(Succeed())
+
+			lines := 0
+			for lines < 10 {
+				var packet string
+				Eventually(packets).Should(Receive(&packet))
+				Expect(len(packet)).To(BeNumerically("<=", 64))
+				lines += len(strings.Split(packet, "\n"))
+			}
+			Expect(lines).To(Equal(10))
+		})
+	})
+
+	Context("when sampling", func() {
+		BeforeEach(func() {
+			config.SampleRate = 0.5
+		})
+
+		It("sends about that share of counters and timers with the sample rate", func() {
+			for i := 0; i < 1000; i++ {
+				Expect(sink.AddToCounter("requests", 1)).To(Succeed())
+			}
+			Expect(sink.SendGauge("queueDepth", 1, "")).To(Succeed())
+			Expect(sink.Flush()).To(Succeed())
+
+			var lines []string
+			Eventually(func() []string {
+				for {
+					select {
+					case packet := <-packets:
+						lines = append(lines, strings.Split(packet, "\n")...)
+					default:
+						return lines
+					}
+				}
+			}).Should(ContainElement("policy-server.queueDepth:1|g"))
+
+			Expect(len(lines)).To(BeNumerically("~", 500, 150))
+			Expect(lines).To(ContainElement("policy-server.requests:1|c|@0.5"))
+		})
+	})
+})
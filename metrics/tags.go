@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// TaggedSink is implemented by sinks that can carry tags natively.
+type TaggedSink interface {
+	Sink
+	SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error
+	AddToCounterWithTags(name string, delta uint64, tags map[string]string) error
+	SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error
+}
+
+// FlattenTags appends tags to name in the Graphite tagged format, sorted by
+// key, e.g. "requestTime;method=GET;status=200". It is how tags reach sinks
+// that do not implement TaggedSink.
+func FlattenTags(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString(";" + k + "=" + tags[k])
+	}
+	return b.String()
+}
+
+// MergeTags combines tag sets. Later sets win on conflicting keys.
+func MergeTags(tagSets ...map[string]string) map[string]string {
+	merged := map[string]string{}
+	for _, tags := range tagSets {
+		for k, v := range tags {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+func sendGauge(sink Sink, name string, value float64, unit string, tags map[string]string) error {
+	if tagged, ok := sink.(TaggedSink); ok {
+		return tagged.SendGaugeWithTags(name, value, unit, tags)
+	}
+	if len(tags) > 0 {
+		name = FlattenTags(name, tags)
+	}
+	return sink.SendGauge(name, value, unit)
+}
+
+func addToCounter(sink Sink, name string, delta uint64, tags map[string]string) error {
+	if tagged, ok := sink.(TaggedSink); ok {
+		return tagged.AddToCounterWithTags(name, delta, tags)
+	}
+	if len(tags) > 0 {
+		name = FlattenTags(name, tags)
+	}
+	return sink.AddToCounter(name, delta)
+}
+
+func sendDuration(sink Sink, name string, duration time.Duration, tags map[string]string) error {
+	if tagged, ok := sink.(TaggedSink); ok {
+		return tagged.SendDurationWithTags(name, duration, tags)
+	}
+	if len(tags) > 0 {
+		name = FlattenTags(name, tags)
+	}
+	return sink.SendDuration(name, duration)
+}
+
+// StaticTagsSink adds process-wide tags such as job, index and AZ to
+// everything sent through it. Sinks without tag support only get the
+// per-call tags flattened into the name; their envelopes already identify the
+// process, and flattening the static tags too would rename every metric.
+type StaticTagsSink struct {
+	Sink Sink
+	Tags map[string]string
+}
+
+func NewStaticTagsSink(sink Sink, tags map[string]string) *StaticTagsSink {
+	return &StaticTagsSink{
+		Sink: sink,
+		Tags: tags,
+	}
+}
+
+func (s *StaticTagsSink) SendGauge(name string, value float64, unit string) error {
+	return s.SendGaugeWithTags(name, value, unit, nil)
+}
+
+func (s *StaticTagsSink) AddToCounter(name string, delta uint64) error {
+	return s.AddToCounterWithTags(name, delta, nil)
+}
+
+func (s *StaticTagsSink) SendDuration(name string, duration time.Duration) error {
+	return s.SendDurationWithTags(name, duration, nil)
+}
+
+func (s *StaticTagsSink) SendGaugeWithTags(name string, value float64, unit string, tags map[string]string) error {
+	return s.each(func(sink Sink) error { return sendGauge(sink, name, value, unit, s.tagsFor(sink, tags)) })
+}
+
+func (s *StaticTagsSink) AddToCounterWithTags(name string, delta uint64, tags map[string]string) error {
+	return s.each(func(sink Sink) error { return addToCounter(sink, name, delta, s.tagsFor(sink, tags)) })
+}
+
+func (s *StaticTagsSink) SendDurationWithTags(name string, duration time.Duration, tags map[string]string) error {
+	return s.each(func(sink Sink) error { return sendDuration(sink, name, duration, s.tagsFor(sink, tags)) })
+}
+
+// each looks through a FanOutSink so that every sink behind it gets the
+// static tags only if it supports tags.
+func (s *StaticTagsSink) each(send func(Sink) error) error {
+	if fanOut, ok := s.Sink.(FanOutSink); ok {
+		return fanOut.each(send)
+	}
+	return send(s.Sink)
+}
+
+func (s *StaticTagsSink) tagsFor(sink Sink, tags map[string]string) map[string]string {
+	if _, ok := sink.(TaggedSink); ok {
+		return MergeTags(s.Tags, tags)
+	}
+	return tags
+}
@@ -0,0 +1,140 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/lager/lagertest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/tedsuo/ifrit"
+)
+
+var _ = Describe("Tags", func() {
+	var (
+		logger     *lagertest.TestLogger
+		prometheus *metrics.PrometheusHandler
+		memory     *metrics.InMemorySink
+	)
+
+	scrape := func() string {
+		resp := httptest.NewRecorder()
+		request, err := http.NewRequest("GET", "/metrics", nil)
+		Expect(err).NotTo(HaveOccurred())
+		prometheus.ServeHTTP(resp, request)
+		return resp.Body.String()
+	}
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		prometheus = metrics.NewPrometheusHandler(logger)
+		memory = metrics.NewInMemorySink()
+	})
+
+	Describe("FlattenTags", func() {
+		It("appends the tags sorted by key", func() {
+			Expect(metrics.FlattenTags("requestTime", map[string]string{"status": "200", "method": "GET"})).
+				To(Equal("requestTime;method=GET;status=200"))
+			Expect(metrics.FlattenTags("requestTime", nil)).To(Equal("requestTime"))
+		})
+	})
+
+	Describe("MergeTags", func() {
+		It("lets later tag sets win", func() {
+			Expect(metrics.MergeTags(
+				map[string]string{"job": "a", "index": "0"},
+				nil,
+				map[string]string{"job": "b"},
+			)).To(Equal(map[string]string{"job": "b", "index": "0"}))
+		})
+	})
+
+	Describe("MetricsSender", func() {
+		It("forwards tags to sinks that support them and flattens them for the rest", func() {
+			sender := metrics.NewMetricsSender(logger, metrics.NewFanOutSink(prometheus, memory))
+			tags := map[string]string{"method": "GET"}
+
+			sender.SendValueWithTags("queueDepth", 3, "", tags)
+			sender.IncrementCounterWithTags("requests", tags)
+			sender.SendDurationWithTags("requestTime", time.Second, tags)
+
+			body := scrape()
+			Expect(body).To(ContainSubstring("queueDepth{method=\"GET\"} 3\n"))
+			Expect(body).To(ContainSubstring("requests_total{method=\"GET\"} 1\n"))
+			Expect(body).To(ContainSubstring("requestTime_seconds{method=\"GET\"} 1\n"))
+
+			gauge, ok := memory.Gauge("queueDepth;method=GET")
+			Expect(ok).To(BeTrue())
+			Expect(gauge.Value).To(Equal(3.0))
+			Expect(memory.Counter("requests;method=GET")).To(Equal(uint64(1)))
+			Expect(memory.Durations("requestTime;method=GET")).To(HaveLen(1))
+		})
+	})
+
+	Describe("StaticTagsSink", func() {
+		var sender *metrics.MetricsSender
+
+		BeforeEach(func() {
+			sink := metrics.NewStaticTagsSink(metrics.NewFanOutSink(prometheus, memory), map[string]string{
+				"job":   "policy-server",
+				"index": "0",
+			})
+			sender = metrics.NewMetricsSender(logger, sink)
+		})
+
+		It("adds the static tags for sinks that support tags", func() {
+			sender.IncrementCounterWithTags("requests", map[string]string{"index": "1"})
+			sender.SendValue("uptime", 5, "seconds")
+
+			body := scrape()
+			Expect(body).To(ContainSubstring("requests_total{index=\"1\",job=\"policy-server\"} 1\n"))
+			Expect(body).To(ContainSubstring("uptime_seconds{index=\"0\",job=\"policy-server\"} 5\n"))
+		})
+
+		It("leaves the static tags out of names for sinks that do not", func() {
+			sender.IncrementCounterWithTags("requests", map[string]string{"method": "GET"})
+			sender.SendValue("uptime", 5, "seconds")
+
+			Expect(memory.Counter("requests;method=GET")).To(Equal(uint64(1)))
+			_, ok := memory.Gauge("uptime")
+			Expect(ok).To(BeTrue())
+		})
+	})
+
+	Describe("MetricSource", func() {
+		var source metrics.MetricSource
+
+		BeforeEach(func() {
+			source = metrics.MetricSource{
+				Name:   "openConnections",
+				Tags:   map[string]string{"database": "policy"},
+				Getter: func() (float64, error) { return 4, nil },
+			}
+		})
+
+		It("emits the source tags", func() {
+			emitter := metrics.NewMetricsEmitterWithSink(logger, time.Hour, metrics.NewFanOutSink(prometheus, memory), source)
+			process := ifrit.Invoke(emitter)
+			process.Signal(os.Interrupt)
+			Eventually(process.Wait()).Should(Receive())
+
+			Expect(scrape()).To(ContainSubstring("openConnections{database=\"policy\"} 4\n"))
+			_, ok := memory.Gauge("openConnections;database=policy")
+			Expect(ok).To(BeTrue())
+		})
+
+		It("serves the source tags as Prometheus labels", func() {
+			prometheus = metrics.NewPrometheusHandler(logger, source)
+			prometheus.SendGaugeWithTags("openConnections", 2, "", map[string]string{"database": "asg\"syncer"})
+
+			Expect(scrape()).To(Equal(`# TYPE openConnections gauge
+openConnections{database="asg\"syncer"} 2
+openConnections{database="policy"} 4
+`))
+		})
+	})
+})
@@ -1,14 +1,18 @@
 package metrics
 
-import "time"
+import "code.cloudfoundry.org/clock"
 
 func NewUptimeSource() MetricSource {
-	startTime := time.Now().Unix()
+	return NewUptimeSourceWithClock(clock.NewClock())
+}
+
+func NewUptimeSourceWithClock(clock clock.Clock) MetricSource {
+	startTime := clock.Now().Unix()
 	return MetricSource{
 		Name: "uptime",
 		Unit: "seconds",
 		Getter: func() (float64, error) {
-			uptime := time.Now().Unix() - startTime
+			uptime := clock.Now().Unix() - startTime
 			return float64(uptime), nil
 		},
 	}
@@ -1,7 +1,10 @@
 package metrics_test
 
 import (
+	"time"
+
 	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/clock/fakeclock"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
@@ -16,4 +19,12 @@ var _ = Describe("UptimeSource", func() {
 		Eventually(uptimeSource.Getter, "2.5s").Should(
 			BeNumerically(">=", 2))
 	})
+
+	It("reads the time from the clock it is given", func() {
+		clock := fakeclock.NewFakeClock(time.Now())
+		uptimeSource := metrics.NewUptimeSourceWithClock(clock)
+
+		clock.Increment(90 * time.Second)
+		Expect(uptimeSource.Getter()).To(Equal(90.0))
+	})
 })
@@ -0,0 +1,198 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package fakes
+
+import (
+	"sync"
+	"time"
+)
+
+type TaggedMetricsSender struct {
+	AddToCounterWithTagsStub        func(string, uint64, map[string]string)
+	addToCounterWithTagsMutex       sync.RWMutex
+	addToCounterWithTagsArgsForCall []struct {
+		arg1 string
+		arg2 uint64
+		arg3 map[string]string
+	}
+	IncrementCounterStub        func(string)
+	incrementCounterMutex       sync.RWMutex
+	incrementCounterArgsForCall []struct {
+		arg1 string
+	}
+	IncrementCounterWithTagsStub        func(string, map[string]string)
+	incrementCounterWithTagsMutex       sync.RWMutex
+	incrementCounterWithTagsArgsForCall []struct {
+		arg1 string
+		arg2 map[string]string
+	}
+	SendDurationStub        func(string, time.Duration)
+	sendDurationMutex       sync.RWMutex
+	sendDurationArgsForCall []struct {
+		arg1 string
+		arg2 time.Duration
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *TaggedMetricsSender) AddToCounterWithTags(arg1 string, arg2 uint64, arg3 map[string]string) {
+	fake.addToCounterWithTagsMutex.Lock()
+	fake.addToCounterWithTagsArgsForCall = append(fake.addToCounterWithTagsArgsForCall, struct {
+		arg1 string
+		arg2 uint64
+		arg3 map[string]string
+	}{arg1, arg2, arg3})
+	stub := fake.AddToCounterWithTagsStub
+	fake.recordInvocation("AddToCounterWithTags", []interface{}{arg1, arg2, arg3})
+	fake.addToCounterWithTagsMutex.Unlock()
+	if stub != nil {
+		fake.AddToCounterWithTagsStub(arg1, arg2, arg3)
+	}
+}
+
+func (fake *TaggedMetricsSender) AddToCounterWithTagsCallCount() int {
+	fake.addToCounterWithTagsMutex.RLock()
+	defer fake.addToCounterWithTagsMutex.RUnlock()
+	return len(fake.addToCounterWithTagsArgsForCall)
+}
+
+func (fake *TaggedMetricsSender) AddToCounterWithTagsCalls(stub func(string, uint64, map[string]string)) {
+	fake.addToCounterWithTagsMutex.Lock()
+	defer fake.addToCounterWithTagsMutex.Unlock()
+	fake.AddToCounterWithTagsStub = stub
+}
+
+func (fake *TaggedMetricsSender) AddToCounterWithTagsArgsForCall(i int) (string, uint64, map[string]string) {
+	fake.addToCounterWithTagsMutex.RLock()
+	defer fake.addToCounterWithTagsMutex.RUnlock()
+	argsForCall := fake.addToCounterWithTagsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *TaggedMetricsSender) IncrementCounter(arg1 string) {
+	fake.incrementCounterMutex.Lock()
+	fake.incrementCounterArgsForCall = append(fake.incrementCounterArgsForCall, struct {
+		arg1 string
+	}{arg1})
+	stub := fake.IncrementCounterStub
+	fake.recordInvocation("IncrementCounter", []interface{}{arg1})
+	fake.incrementCounterMutex.Unlock()
+	if stub != nil {
+		fake.IncrementCounterStub(arg1)
+	}
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterCallCount() int {
+	fake.incrementCounterMutex.RLock()
+	defer fake.incrementCounterMutex.RUnlock()
+	return len(fake.incrementCounterArgsForCall)
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterCalls(stub func(string)) {
+	fake.incrementCounterMutex.Lock()
+	defer fake.incrementCounterMutex.Unlock()
+	fake.IncrementCounterStub = stub
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterArgsForCall(i int) string {
+	fake.incrementCounterMutex.RLock()
+	defer fake.incrementCounterMutex.RUnlock()
+	argsForCall := fake.incrementCounterArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterWithTags(arg1 string, arg2 map[string]string) {
+	fake.incrementCounterWithTagsMutex.Lock()
+	fake.incrementCounterWithTagsArgsForCall = append(fake.incrementCounterWithTagsArgsForCall, struct {
+		arg1 string
+		arg2 map[string]string
+	}{arg1, arg2})
+	stub := fake.IncrementCounterWithTagsStub
+	fake.recordInvocation("IncrementCounterWithTags", []interface{}{arg1, arg2})
+	fake.incrementCounterWithTagsMutex.Unlock()
+	if stub != nil {
+		fake.IncrementCounterWithTagsStub(arg1, arg2)
+	}
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterWithTagsCallCount() int {
+	fake.incrementCounterWithTagsMutex.RLock()
+	defer fake.incrementCounterWithTagsMutex.RUnlock()
+	return len(fake.incrementCounterWithTagsArgsForCall)
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterWithTagsCalls(stub func(string, map[string]string)) {
+	fake.incrementCounterWithTagsMutex.Lock()
+	defer fake.incrementCounterWithTagsMutex.Unlock()
+	fake.IncrementCounterWithTagsStub = stub
+}
+
+func (fake *TaggedMetricsSender) IncrementCounterWithTagsArgsForCall(i int) (string, map[string]string) {
+	fake.incrementCounterWithTagsMutex.RLock()
+	defer fake.incrementCounterWithTagsMutex.RUnlock()
+	argsForCall := fake.incrementCounterWithTagsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *TaggedMetricsSender) SendDuration(arg1 string, arg2 time.Duration) {
+	fake.sendDurationMutex.Lock()
+	fake.sendDurationArgsForCall = append(fake.sendDurationArgsForCall, struct {
+		arg1 string
+		arg2 time.Duration
+	}{arg1, arg2})
+	stub := fake.SendDurationStub
+	fake.recordInvocation("SendDuration", []interface{}{arg1, arg2})
+	fake.sendDurationMutex.Unlock()
+	if stub != nil {
+		fake.SendDurationStub(arg1, arg2)
+	}
+}
+
+func (fake *TaggedMetricsSender) SendDurationCallCount() int {
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	return len(fake.sendDurationArgsForCall)
+}
+
+func (fake *TaggedMetricsSender) SendDurationCalls(stub func(string, time.Duration)) {
+	fake.sendDurationMutex.Lock()
+	defer fake.sendDurationMutex.Unlock()
+	fake.SendDurationStub = stub
+}
+
+func (fake *TaggedMetricsSender) SendDurationArgsForCall(i int) (string, time.Duration) {
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	argsForCall := fake.sendDurationArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *TaggedMetricsSender) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	fake.addToCounterWithTagsMutex.RLock()
+	defer fake.addToCounterWithTagsMutex.RUnlock()
+	fake.incrementCounterMutex.RLock()
+	defer fake.incrementCounterMutex.RUnlock()
+	fake.incrementCounterWithTagsMutex.RLock()
+	defer fake.incrementCounterWithTagsMutex.RUnlock()
+	fake.sendDurationMutex.RLock()
+	defer fake.sendDurationMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *TaggedMetricsSender) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
@@ -3,7 +3,12 @@ package middleware
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/metrics"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
 )
 
 //go:generate counterfeiter -o fakes/metrics_sender.go --fake-name MetricsSender . metricsSender
@@ -12,21 +17,160 @@ type metricsSender interface {
 	IncrementCounter(string)
 }
 
+// taggedMetricsSender is a metricsSender that takes tags, such as
+// *metrics.MetricsSender.
+//
+//go:generate counterfeiter -o fakes/tagged_metrics_sender.go --fake-name TaggedMetricsSender . taggedMetricsSender
+type taggedMetricsSender interface {
+	metricsSender
+	IncrementCounterWithTags(string, map[string]string)
+	AddToCounterWithTags(string, uint64, map[string]string)
+}
+
 //go:generate counterfeiter -o fakes/http_handler.go --fake-name HTTPHandler . http_handler
 type http_handler interface {
 	http.Handler
 }
 
+//go:generate counterfeiter -o fakes/histogram.go --fake-name Histogram . histogram
+type histogram interface {
+	Observe(time.Duration)
+}
+
+// MetricWrapper sends <Name>RequestTime and <Name>RequestCount for every
+// request. If the MetricsSender takes tags, it also sends <Name>ResponseCount
+// tagged with the status class (e.g. "5xx") and adds the bytes written to
+// the <Name>ResponseBytes counter.
 type MetricWrapper struct {
 	Name          string
 	MetricsSender metricsSender
+	// RequestTimes, when set, aggregates request durations (see
+	// metrics.Histogram) instead of sending one metric per request.
+	RequestTimes histogram
+	// Spans, when set, records a server span for each request. It continues
+	// the trace of an incoming traceparent header and is available to the
+	// handler through tracing.SpanFromContext.
+	Spans tracing.SpanRecorder
+	// Route, when set, is the route template, e.g. "/policies/{id}", added
+	// as a route tag to the response metrics.
+	Route string
+
+	counts *responseCounts
+}
+
+// responseCounts is shared by the handlers of Wrap and ErrorRateSource. It
+// is kept behind a pointer so that MetricWrapper can be copied.
+type responseCounts struct {
+	lock         sync.Mutex
+	requests     float64
+	serverErrors float64
 }
 
+// responseCountsLock guards setting up MetricWrapper.counts, which is done
+// once per wrapper, so one lock for all of them does not slow requests down.
+var responseCountsLock sync.Mutex
+
 func (mw *MetricWrapper) Wrap(handle http.Handler) http.Handler {
+	counts := mw.responseCounts()
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
 		startTime := time.Now()
-		handle.ServeHTTP(w, req)
-		mw.MetricsSender.SendDuration(fmt.Sprintf("%sRequestTime", mw.Name), time.Now().Sub(startTime))
+		rw := NewResponseWriter(w)
+		if mw.Spans != nil {
+			span := mw.startSpan(req)
+			defer func() {
+				span.End = time.Now()
+				span.Attributes["http.status_code"] = strconv.Itoa(rw.Status())
+				mw.Spans.RecordSpan(span)
+			}()
+			req = req.WithContext(tracing.ContextWithSpan(req.Context(), span))
+		}
+		handle.ServeHTTP(rw, req)
+		if mw.RequestTimes != nil {
+			mw.RequestTimes.Observe(time.Now().Sub(startTime))
+		} else {
+			mw.MetricsSender.SendDuration(fmt.Sprintf("%sRequestTime", mw.Name), time.Now().Sub(startTime))
+		}
 		mw.MetricsSender.IncrementCounter(fmt.Sprintf("%sRequestCount", mw.Name))
+		mw.sendResponseMetrics(counts, rw)
 	})
 }
+
+// ErrorRateSource reports the fraction of responses since the last emit
+// that had a 5xx status.
+func (mw *MetricWrapper) ErrorRateSource() metrics.MetricSource {
+	counts := mw.responseCounts()
+	source := metrics.NewRatioSource(fmt.Sprintf("%sErrorRate", mw.Name),
+		metrics.MetricSource{Getter: func() (float64, error) { return counts.get(true), nil }},
+		metrics.MetricSource{Getter: func() (float64, error) { return counts.get(false), nil }},
+	)
+	source.Tags = mw.routeTags()
+	return source
+}
+
+func (mw *MetricWrapper) responseCounts() *responseCounts {
+	responseCountsLock.Lock()
+	defer responseCountsLock.Unlock()
+	if mw.counts == nil {
+		mw.counts = &responseCounts{}
+	}
+	return mw.counts
+}
+
+func (c *responseCounts) add(status int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.requests++
+	if status >= http.StatusInternalServerError {
+		c.serverErrors++
+	}
+}
+
+func (c *responseCounts) get(serverErrors bool) float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if serverErrors {
+		return c.serverErrors
+	}
+	return c.requests
+}
+
+func (mw *MetricWrapper) routeTags() map[string]string {
+	tags := map[string]string{}
+	if mw.Route != "" {
+		tags["route"] = mw.Route
+	}
+	return tags
+}
+
+func (mw *MetricWrapper) sendResponseMetrics(counts *responseCounts, rw ResponseWriter) {
+	counts.add(rw.Status())
+
+	sender, ok := mw.MetricsSender.(taggedMetricsSender)
+	if !ok {
+		return
+	}
+
+	tags := mw.routeTags()
+	sender.AddToCounterWithTags(fmt.Sprintf("%sResponseBytes", mw.Name), uint64(rw.BytesWritten()), tags)
+
+	tags = metrics.MergeTags(tags, map[string]string{"status_class": statusClass(rw.Status())})
+	sender.IncrementCounterWithTags(fmt.Sprintf("%sResponseCount", mw.Name), tags)
+}
+
+func statusClass(status int) string {
+	return fmt.Sprintf("%dxx", status/100)
+}
+
+func (mw *MetricWrapper) startSpan(req *http.Request) tracing.Span {
+	var parent *tracing.Span
+	if remote, err := tracing.ParseTraceparent(req.Header.Get("traceparent")); err == nil {
+		parent = &remote
+	}
+
+	span := tracing.StartSpan(fmt.Sprintf("%s %s", req.Method, mw.Name), tracing.SpanKindServer, parent)
+	span.Attributes = map[string]string{
+		"http.method": req.Method,
+		"http.target": req.URL.Path,
+	}
+	return span
+}
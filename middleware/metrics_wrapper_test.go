@@ -7,6 +7,9 @@ import (
 
 	"code.cloudfoundry.org/cf-networking-helpers/middleware"
 	"code.cloudfoundry.org/cf-networking-helpers/middleware/fakes"
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+
+	rootfakes "code.cloudfoundry.org/cf-networking-helpers/fakes"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -19,11 +22,11 @@ var _ = Describe("MetricsWrapper", func() {
 		innerHandler      *fakes.HTTPHandler
 		outerHandler      http.Handler
 		metricWrapper     *middleware.MetricWrapper
-		fakeMetricsSender *fakes.MetricsSender
+		fakeMetricsSender *fakes.TaggedMetricsSender
 	)
 	Describe("Wrap", func() {
 		BeforeEach(func() {
-			fakeMetricsSender = &fakes.MetricsSender{}
+			fakeMetricsSender = &fakes.TaggedMetricsSender{}
 			metricWrapper = &middleware.MetricWrapper{
 				Name:          "name",
 				MetricsSender: fakeMetricsSender,
@@ -55,5 +58,181 @@ var _ = Describe("MetricsWrapper", func() {
 			outerHandler.ServeHTTP(resp, request)
 			Expect(innerHandler.ServeHTTPCallCount()).To(Equal(1))
 		})
+
+		Context("when the handler responds", func() {
+			BeforeEach(func() {
+				resp = httptest.NewRecorder()
+				innerHandler.ServeHTTPStub = func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					w.Write([]byte("try later"))
+				}
+			})
+
+			It("counts the response by status class", func() {
+				outerHandler.ServeHTTP(resp, request)
+				Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+
+				Expect(fakeMetricsSender.IncrementCounterWithTagsCallCount()).To(Equal(1))
+				name, tags := fakeMetricsSender.IncrementCounterWithTagsArgsForCall(0)
+				Expect(name).To(Equal("nameResponseCount"))
+				Expect(tags).To(Equal(map[string]string{"status_class": "5xx"}))
+			})
+
+			It("counts the bytes written", func() {
+				outerHandler.ServeHTTP(resp, request)
+
+				Expect(fakeMetricsSender.AddToCounterWithTagsCallCount()).To(Equal(1))
+				name, delta, _ := fakeMetricsSender.AddToCounterWithTagsArgsForCall(0)
+				Expect(name).To(Equal("nameResponseBytes"))
+				Expect(delta).To(Equal(uint64(9)))
+			})
+
+			Context("when the sender does not take tags", func() {
+				var untaggedSender *fakes.MetricsSender
+
+				BeforeEach(func() {
+					untaggedSender = &fakes.MetricsSender{}
+					metricWrapper.MetricsSender = untaggedSender
+					outerHandler = metricWrapper.Wrap(innerHandler)
+				})
+
+				It("sends only the request metrics", func() {
+					outerHandler.ServeHTTP(resp, request)
+					Expect(resp.Code).To(Equal(http.StatusServiceUnavailable))
+					Expect(untaggedSender.SendDurationCallCount()).To(Equal(1))
+					Expect(untaggedSender.IncrementCounterCallCount()).To(Equal(1))
+				})
+
+				It("still counts the responses for ErrorRateSource", func() {
+					source := metricWrapper.ErrorRateSource()
+					Expect(source.Getter()).To(Equal(0.0))
+					outerHandler.ServeHTTP(resp, request)
+					Expect(source.Getter()).To(Equal(1.0))
+				})
+			})
+
+			Context("when a route is set", func() {
+				BeforeEach(func() {
+					metricWrapper.Route = "/policies/{id}"
+				})
+
+				It("tags the response metrics with it", func() {
+					outerHandler.ServeHTTP(resp, request)
+
+					_, tags := fakeMetricsSender.IncrementCounterWithTagsArgsForCall(0)
+					Expect(tags).To(Equal(map[string]string{"status_class": "5xx", "route": "/policies/{id}"}))
+					_, _, tags = fakeMetricsSender.AddToCounterWithTagsArgsForCall(0)
+					Expect(tags).To(Equal(map[string]string{"route": "/policies/{id}"}))
+				})
+			})
+		})
+
+		Describe("ErrorRateSource", func() {
+			It("reports the fraction of 5xx responses since the last read", func() {
+				source := metricWrapper.ErrorRateSource()
+				Expect(source.Name).To(Equal("nameErrorRate"))
+				Expect(source.Getter()).To(Equal(0.0))
+
+				statuses := []int{http.StatusOK, http.StatusInternalServerError, http.StatusNotFound, http.StatusBadGateway}
+				for _, status := range statuses {
+					status := status
+					innerHandler.ServeHTTPStub = func(w http.ResponseWriter, req *http.Request) {
+						w.WriteHeader(status)
+					}
+					outerHandler.ServeHTTP(httptest.NewRecorder(), request)
+				}
+				Expect(source.Getter()).To(Equal(0.5))
+
+				outerHandler.ServeHTTP(httptest.NewRecorder(), request)
+				Expect(source.Getter()).To(Equal(1.0))
+			})
+
+			It("shares the counts with a handler wrapped at the same time", func() {
+				metricWrapper = &middleware.MetricWrapper{
+					Name:          "name",
+					MetricsSender: fakeMetricsSender,
+				}
+				innerHandler.ServeHTTPStub = func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+
+				handlers := make(chan http.Handler, 1)
+				go func() {
+					handlers <- metricWrapper.Wrap(innerHandler)
+				}()
+				source := metricWrapper.ErrorRateSource()
+				Expect(source.Getter()).To(Equal(0.0))
+
+				var handler http.Handler
+				Eventually(handlers).Should(Receive(&handler))
+				handler.ServeHTTP(httptest.NewRecorder(), request)
+				Expect(source.Getter()).To(Equal(1.0))
+			})
+
+			It("counts the responses of a wrapper copied after Wrap", func() {
+				copied := *metricWrapper
+				source := copied.ErrorRateSource()
+				Expect(source.Getter()).To(Equal(0.0))
+
+				innerHandler.ServeHTTPStub = func(w http.ResponseWriter, req *http.Request) {
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+				outerHandler.ServeHTTP(httptest.NewRecorder(), request)
+				Expect(source.Getter()).To(Equal(1.0))
+			})
+		})
+
+		Context("when a request time histogram is set", func() {
+			var fakeHistogram *fakes.Histogram
+
+			BeforeEach(func() {
+				fakeHistogram = &fakes.Histogram{}
+				metricWrapper.RequestTimes = fakeHistogram
+			})
+
+			It("observes the request duration instead of sending it", func() {
+				outerHandler.ServeHTTP(resp, request)
+				Expect(fakeHistogram.ObserveCallCount()).To(Equal(1))
+				Expect(fakeMetricsSender.SendDurationCallCount()).To(Equal(0))
+				Expect(fakeMetricsSender.IncrementCounterCallCount()).To(Equal(1))
+			})
+		})
+
+		Context("when a span recorder is set", func() {
+			var fakeSpans *rootfakes.SpanRecorder
+
+			BeforeEach(func() {
+				fakeSpans = &rootfakes.SpanRecorder{}
+				metricWrapper.Spans = fakeSpans
+			})
+
+			It("records a server span for the request", func() {
+				outerHandler.ServeHTTP(resp, request)
+				Expect(fakeSpans.RecordSpanCallCount()).To(Equal(1))
+
+				span := fakeSpans.RecordSpanArgsForCall(0)
+				Expect(span.Name).To(Equal("GET name"))
+				Expect(span.Kind).To(Equal(tracing.SpanKindServer))
+				Expect(span.TraceID.IsValid()).To(BeTrue())
+				Expect(span.ParentSpanID.IsValid()).To(BeFalse())
+				Expect(span.End).To(BeTemporally(">=", span.Start))
+				Expect(span.Attributes).To(HaveKeyWithValue("http.method", "GET"))
+				Expect(span.Attributes).To(HaveKeyWithValue("http.status_code", "200"))
+			})
+
+			It("continues the trace of the traceparent header and passes the span to the handler", func() {
+				request.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+				outerHandler.ServeHTTP(resp, request)
+
+				span := fakeSpans.RecordSpanArgsForCall(0)
+				Expect(span.TraceID.String()).To(Equal("4bf92f3577b34da6a3ce929d0e0e4736"))
+				Expect(span.ParentSpanID.String()).To(Equal("00f067aa0ba902b7"))
+
+				_, innerRequest := innerHandler.ServeHTTPArgsForCall(0)
+				handlerSpan, ok := tracing.SpanFromContext(innerRequest.Context())
+				Expect(ok).To(BeTrue())
+				Expect(handlerSpan.SpanID).To(Equal(span.SpanID))
+			})
+		})
 	})
 })
@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+)
+
+// ResponseWriter records the status and body size of a response.
+type ResponseWriter interface {
+	http.ResponseWriter
+	// Status returns the status written, or 200 if the handler did not
+	// write one.
+	Status() int
+	BytesWritten() int64
+}
+
+// NewResponseWriter wraps w so that the response can be measured. The
+// wrapper implements http.Flusher, http.Hijacker and http.Pusher exactly
+// when w does, so handlers see the same capabilities as without it.
+func NewResponseWriter(w http.ResponseWriter) ResponseWriter {
+	r := &responseWriter{ResponseWriter: w}
+
+	flusher, isFlusher := w.(http.Flusher)
+	hijacker, isHijacker := w.(http.Hijacker)
+	pusher, isPusher := w.(http.Pusher)
+
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{r, flusher, hijacker, pusher}
+	case isFlusher && isHijacker:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Hijacker
+		}{r, flusher, hijacker}
+	case isFlusher && isPusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+			http.Pusher
+		}{r, flusher, pusher}
+	case isHijacker && isPusher:
+		return struct {
+			*responseWriter
+			http.Hijacker
+			http.Pusher
+		}{r, hijacker, pusher}
+	case isFlusher:
+		return struct {
+			*responseWriter
+			http.Flusher
+		}{r, flusher}
+	case isHijacker:
+		return struct {
+			*responseWriter
+			http.Hijacker
+		}{r, hijacker}
+	case isPusher:
+		return struct {
+			*responseWriter
+			http.Pusher
+		}{r, pusher}
+	default:
+		return r
+	}
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *responseWriter) WriteHeader(status int) {
+	if r.status < http.StatusOK {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseWriter) Write(b []byte) (int, error) {
+	if r.status < http.StatusOK {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+func (r *responseWriter) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+func (r *responseWriter) BytesWritten() int64 {
+	return r.bytes
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *responseWriter) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,93 @@
+package middleware_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	"code.cloudfoundry.org/cf-networking-helpers/middleware"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type hijackablePusher struct {
+	http.ResponseWriter
+	hijacked bool
+	pushed   string
+}
+
+func (h *hijackablePusher) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func (h *hijackablePusher) Push(target string, opts *http.PushOptions) error {
+	h.pushed = target
+	return nil
+}
+
+var _ = Describe("ResponseWriter", func() {
+	var recorder *httptest.ResponseRecorder
+
+	BeforeEach(func() {
+		recorder = httptest.NewRecorder()
+	})
+
+	It("records the status and bytes written", func() {
+		rw := middleware.NewResponseWriter(recorder)
+		rw.WriteHeader(http.StatusTeapot)
+		rw.WriteHeader(http.StatusInternalServerError)
+		_, err := rw.Write([]byte("short and stout"))
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(rw.Status()).To(Equal(http.StatusTeapot))
+		Expect(rw.BytesWritten()).To(Equal(int64(15)))
+		Expect(recorder.Code).To(Equal(http.StatusTeapot))
+		Expect(recorder.Body.String()).To(Equal("short and stout"))
+	})
+
+	It("reports 200 when the handler does not write a status", func() {
+		rw := middleware.NewResponseWriter(recorder)
+		Expect(rw.Status()).To(Equal(http.StatusOK))
+
+		_, err := rw.Write([]byte("ok"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rw.Status()).To(Equal(http.StatusOK))
+	})
+
+	It("records the final status after informational ones", func() {
+		rw := middleware.NewResponseWriter(recorder)
+		rw.WriteHeader(http.StatusContinue)
+		rw.WriteHeader(http.StatusAccepted)
+		Expect(rw.Status()).To(Equal(http.StatusAccepted))
+	})
+
+	It("only implements the optional interfaces of the underlying writer", func() {
+		rw := middleware.NewResponseWriter(recorder)
+		_, isFlusher := rw.(http.Flusher)
+		_, isHijacker := rw.(http.Hijacker)
+		_, isPusher := rw.(http.Pusher)
+		Expect(isFlusher).To(BeTrue())
+		Expect(isHijacker).To(BeFalse())
+		Expect(isPusher).To(BeFalse())
+
+		rw.(http.Flusher).Flush()
+		Expect(recorder.Flushed).To(BeTrue())
+	})
+
+	It("passes hijacking and pushes through", func() {
+		inner := &hijackablePusher{ResponseWriter: recorder}
+		rw := middleware.NewResponseWriter(inner)
+		_, isFlusher := rw.(http.Flusher)
+		Expect(isFlusher).To(BeFalse())
+
+		_, _, err := rw.(http.Hijacker).Hijack()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(inner.hijacked).To(BeTrue())
+
+		Expect(rw.(http.Pusher).Push("/style.css", nil)).To(Succeed())
+		Expect(inner.pushed).To(Equal("/style.css"))
+	})
+})
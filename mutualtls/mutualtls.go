@@ -35,6 +35,20 @@ func NewClientTLSConfig(certFile, keyFile, caCertFile string) (*tls.Config, erro
 	return c, nil
 }
 
+// NewClientTLSConfigWithoutCert verifies the server like NewClientTLSConfig,
+// for servers that do not ask for a client certificate.
+func NewClientTLSConfigWithoutCert(caCertFile string) (*tls.Config, error) {
+	caCertPool, err := newCACertPool(caCertFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		RootCAs:    caCertPool,
+		MinVersion: tls.VersionTLS12,
+		MaxVersion: tls.VersionTLS12,
+	}, nil
+}
+
 func newTLSConfig(certFile, keyFile string) (*tls.Config, error) {
 	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
 	if err != nil {
@@ -196,4 +196,30 @@ var _ = Describe("TLS config for internal API server", func() {
 		})
 
 	})
+
+	Describe("Client TLS Config without a cert", func() {
+		It("verifies servers that do not ask for a client certificate", func() {
+			serverTLSConfig.ClientAuth = tls.NoClientCert
+			server := startServer(serverTLSConfig)
+
+			clientTLSConfig, err := mutualtls.NewClientTLSConfigWithoutCert(paths.ServerCACertPath)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(clientTLSConfig.Certificates).To(BeEmpty())
+
+			resp, err := makeRequest(serverListenAddr, clientTLSConfig)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Body.Close()).To(Succeed())
+
+			server.Signal(os.Interrupt)
+			Eventually(server.Wait()).Should(Receive())
+		})
+
+		Context("when the CA cert file cannot be read", func() {
+			It("returns a meaningful error", func() {
+				_, err := mutualtls.NewClientTLSConfigWithoutCert("")
+				Expect(err).To(MatchError(HavePrefix("failed read ca cert file")))
+			})
+		})
+	})
 })
@@ -10,7 +10,6 @@ import (
 	"code.cloudfoundry.org/cf-networking-helpers/db"
 	"code.cloudfoundry.org/lager/lagertest"
 
-	"log"
 	"time"
 
 	"github.com/onsi/ginkgo"
@@ -22,9 +21,10 @@ func CreateDatabase(config db.Config) {
 	dbToCreate := config.DatabaseName
 	config.DatabaseName = ""
 	fmt.Fprintln(ginkgo.GinkgoWriter, fmt.Sprintf("%s Creating database %s", time.Now().String(), dbToCreate))
-	connection := getDbConnection(config)
-	defer connection.ConnectionPool.Close()
-	_, err := connection.ConnectionPool.Exec(fmt.Sprintf("CREATE DATABASE %s", dbToCreate))
+	connection, err := getDbConnection(config)
+	Expect(err).NotTo(HaveOccurred())
+	defer connection.Close()
+	_, err = connection.Exec(fmt.Sprintf("CREATE DATABASE %s", dbToCreate))
 	Expect(err).NotTo(HaveOccurred())
 }
 
@@ -34,9 +34,13 @@ func RemoveDatabase(config db.Config) {
 	dbToDrop := config.DatabaseName
 	config.DatabaseName = ""
 
-	connection := getDbConnection(config)
-	defer connection.ConnectionPool.Close()
-	_, err := connection.ConnectionPool.Exec(fmt.Sprintf("DROP DATABASE %s", dbToDrop))
+	connection, err := getDbConnection(config)
+	if err != nil {
+		fmt.Fprintln(ginkgo.GinkgoWriter, fmt.Sprintf("%+v", err))
+		return
+	}
+	defer connection.Close()
+	_, err = connection.Exec(fmt.Sprintf("DROP DATABASE %s", dbToDrop))
 	if err != nil {
 		fmt.Fprintln(ginkgo.GinkgoWriter, fmt.Sprintf("%+v", err))
 	}
@@ -47,7 +51,7 @@ type dbConnection struct {
 	Err            error
 }
 
-func getDbConnection(conf db.Config) dbConnection {
+func getDbConnection(conf db.Config) (*db.ConnWrapper, error) {
 	retriableConnector := db.RetriableConnector{
 		Logger:        lagertest.NewTestLogger("test"),
 		Connector:     db.GetConnectionPool,
@@ -56,7 +60,7 @@ func getDbConnection(conf db.Config) dbConnection {
 		MaxRetries:    0,
 	}
 
-	channel := make(chan dbConnection)
+	channel := make(chan dbConnection, 1)
 	go func() {
 		connection, err := retriableConnector.GetConnectionPool(conf, context.Background())
 		channel <- dbConnection{connection, err}
@@ -65,12 +69,12 @@ func getDbConnection(conf db.Config) dbConnection {
 	select {
 	case connectionResult = <-channel:
 	case <-time.After(5 * time.Second):
-		log.Fatalf("%s.testsupport: db connection timeout", "db-helper")
+		return nil, fmt.Errorf("%s.testsupport: db connection timeout", "db-helper")
 	}
 	if connectionResult.Err != nil {
-		log.Fatalf("%s.testsupport: db connect: %s", "db-helper", connectionResult.Err)
+		return nil, fmt.Errorf("%s.testsupport: db connect: %s", "db-helper", connectionResult.Err)
 	}
-	return connectionResult
+	return connectionResult.ConnectionPool, nil
 }
 
 const DefaultDBTimeout = 5
@@ -0,0 +1,291 @@
+package testsupport
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const faultProxyChunkSize = 32 * 1024
+
+// FaultProxy is a TCP proxy for tests that forwards connections to a target
+// address and can inject network faults at runtime.
+type FaultProxy struct {
+	target   string
+	listener net.Listener
+
+	lock          sync.Mutex
+	latency       time.Duration
+	bandwidth     int
+	blackHoled    bool
+	halfOpen      bool
+	closed        bool
+	conns         map[*faultProxyConn]struct{}
+	blackHoleDone chan struct{}
+
+	wg sync.WaitGroup
+}
+
+type faultProxyConn struct {
+	client   net.Conn
+	upstream net.Conn
+}
+
+func NewFaultProxy(target string) (*FaultProxy, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("listen: %s", err)
+	}
+
+	p := &FaultProxy{
+		target:        target,
+		listener:      listener,
+		conns:         map[*faultProxyConn]struct{}{},
+		blackHoleDone: make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.acceptLoop()
+	return p, nil
+}
+
+func (p *FaultProxy) Address() string {
+	return p.listener.Addr().String()
+}
+
+func (p *FaultProxy) Host() string {
+	host, _, _ := net.SplitHostPort(p.Address())
+	return host
+}
+
+func (p *FaultProxy) Port() uint16 {
+	_, port, _ := net.SplitHostPort(p.Address())
+	portNum, _ := strconv.Atoi(port)
+	return uint16(portNum)
+}
+
+// SetLatency delays every chunk of data forwarded in either direction.
+func (p *FaultProxy) SetLatency(latency time.Duration) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.latency = latency
+}
+
+// SetBandwidth limits each direction of each connection to the given number
+// of bytes per second. Zero removes the limit.
+func (p *FaultProxy) SetBandwidth(bytesPerSecond int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.bandwidth = bytesPerSecond
+}
+
+// SetBlackHole makes the proxy silently discard all data in both directions
+// while leaving connections open. New connections are accepted but never
+// forwarded to the target until the black hole is removed.
+func (p *FaultProxy) SetBlackHole(enabled bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.blackHoled == enabled {
+		return
+	}
+	p.blackHoled = enabled
+	if !enabled {
+		close(p.blackHoleDone)
+		p.blackHoleDone = make(chan struct{})
+	}
+}
+
+// SetHalfOpen makes the proxy close the upstream side of every connection
+// while keeping the client side open and discarding anything it sends, as
+// if the server had gone away without the client noticing.
+func (p *FaultProxy) SetHalfOpen(enabled bool) {
+	p.lock.Lock()
+	p.halfOpen = enabled
+	var conns []*faultProxyConn
+	if enabled {
+		for conn := range p.conns {
+			conns = append(conns, conn)
+		}
+	}
+	p.lock.Unlock()
+
+	for _, conn := range conns {
+		conn.upstream.Close()
+	}
+}
+
+// ResetConnections aborts every open connection with a TCP reset.
+func (p *FaultProxy) ResetConnections() {
+	p.lock.Lock()
+	var conns []*faultProxyConn
+	for conn := range p.conns {
+		conns = append(conns, conn)
+	}
+	p.lock.Unlock()
+
+	for _, conn := range conns {
+		resetConn(conn.client)
+		resetConn(conn.upstream)
+	}
+}
+
+// Close stops accepting connections and closes all open ones.
+func (p *FaultProxy) Close() error {
+	err := p.listener.Close()
+
+	p.lock.Lock()
+	p.closed = true
+	for conn := range p.conns {
+		conn.client.Close()
+		conn.upstream.Close()
+	}
+	if p.blackHoled {
+		p.blackHoled = false
+		close(p.blackHoleDone)
+	}
+	p.lock.Unlock()
+
+	p.wg.Wait()
+	return err
+}
+
+func (p *FaultProxy) acceptLoop() {
+	defer p.wg.Done()
+	for {
+		client, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		p.wg.Add(1)
+		go p.handle(client)
+	}
+}
+
+func (p *FaultProxy) handle(client net.Conn) {
+	defer p.wg.Done()
+	defer client.Close()
+
+	if !p.waitForBlackHole(client) {
+		return
+	}
+
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		resetConn(client)
+		return
+	}
+	defer upstream.Close()
+
+	conn := &faultProxyConn{client: client, upstream: upstream}
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		return
+	}
+	p.conns[conn] = struct{}{}
+	p.lock.Unlock()
+
+	defer func() {
+		p.lock.Lock()
+		delete(p.conns, conn)
+		p.lock.Unlock()
+	}()
+
+	errs := make(chan error, 2)
+	go func() { errs <- p.pipe(upstream, client, true) }()
+	go func() { errs <- p.pipe(client, upstream, false) }()
+
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		if err == io.EOF || p.isHalfOpen() {
+			continue
+		}
+		client.Close()
+		upstream.Close()
+	}
+}
+
+// waitForBlackHole holds a freshly accepted connection, draining anything
+// the client sends, until the black hole is removed or the client goes away.
+// It returns false if the client went away.
+func (p *FaultProxy) waitForBlackHole(client net.Conn) bool {
+	p.lock.Lock()
+	blackHoled, released := p.blackHoled, p.blackHoleDone
+	p.lock.Unlock()
+	if !blackHoled {
+		return true
+	}
+
+	clientGone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, client)
+		close(clientGone)
+	}()
+
+	select {
+	case <-released:
+		client.SetReadDeadline(time.Now())
+		<-clientGone
+		client.SetReadDeadline(time.Time{})
+		return true
+	case <-clientGone:
+		return false
+	}
+}
+
+// pipe copies from src to dst until either side fails, applying whatever
+// faults are configured at the time each chunk is read. A clean EOF from src
+// is forwarded to dst as a half-close.
+func (p *FaultProxy) pipe(dst, src net.Conn, fromClient bool) error {
+	buffer := make([]byte, faultProxyChunkSize)
+	for {
+		p.lock.Lock()
+		readSize := len(buffer)
+		if p.bandwidth > 0 && p.bandwidth < readSize {
+			readSize = p.bandwidth
+		}
+		p.lock.Unlock()
+
+		n, err := src.Read(buffer[:readSize])
+		if n > 0 {
+			p.lock.Lock()
+			latency, bandwidth := p.latency, p.bandwidth
+			discard := p.blackHoled || (fromClient && p.halfOpen)
+			p.lock.Unlock()
+
+			if !discard {
+				delay := latency
+				if bandwidth > 0 {
+					delay += time.Duration(n) * time.Second / time.Duration(bandwidth)
+				}
+				time.Sleep(delay)
+
+				if _, writeErr := dst.Write(buffer[:n]); writeErr != nil {
+					return writeErr
+				}
+			}
+		}
+		if err != nil {
+			if tcpConn, ok := dst.(*net.TCPConn); ok && err == io.EOF {
+				tcpConn.CloseWrite()
+			}
+			return err
+		}
+	}
+}
+
+func (p *FaultProxy) isHalfOpen() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.halfOpen
+}
+
+func resetConn(conn net.Conn) {
+	if tcpConn, ok := conn.(*net.TCPConn); ok {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
@@ -0,0 +1,144 @@
+package testsupport_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FaultProxy", func() {
+	var (
+		echoServer net.Listener
+		proxy      *testsupport.FaultProxy
+	)
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		conn, err := net.Dial("tcp", proxy.Address())
+		Expect(err).NotTo(HaveOccurred())
+		return conn, bufio.NewReader(conn)
+	}
+
+	roundTrip := func(conn net.Conn, reader *bufio.Reader, message string) (string, error) {
+		conn.SetDeadline(time.Now().Add(500 * time.Millisecond))
+		defer conn.SetDeadline(time.Time{})
+		if _, err := conn.Write([]byte(message + "\n")); err != nil {
+			return "", err
+		}
+		line, err := reader.ReadString('\n')
+		return strings.TrimSpace(line), err
+	}
+
+	BeforeEach(func() {
+		var err error
+		echoServer, err = net.Listen("tcp", "127.0.0.1:0")
+		Expect(err).NotTo(HaveOccurred())
+		go func() {
+			for {
+				conn, err := echoServer.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					defer conn.Close()
+					io.Copy(conn, conn)
+				}()
+			}
+		}()
+
+		proxy, err = testsupport.NewFaultProxy(echoServer.Addr().String())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(proxy.Close()).To(Succeed())
+		echoServer.Close()
+	})
+
+	It("forwards traffic to the target", func() {
+		conn, reader := dial()
+		defer conn.Close()
+
+		Expect(roundTrip(conn, reader, "hello")).To(Equal("hello"))
+		Expect(proxy.Host()).To(Equal("127.0.0.1"))
+		Expect(proxy.Port()).NotTo(BeZero())
+	})
+
+	It("injects latency", func() {
+		conn, reader := dial()
+		defer conn.Close()
+
+		proxy.SetLatency(100 * time.Millisecond)
+		start := time.Now()
+		Expect(roundTrip(conn, reader, "slow")).To(Equal("slow"))
+		Expect(time.Since(start)).To(BeNumerically(">=", 200*time.Millisecond))
+	})
+
+	It("limits bandwidth", func() {
+		conn, reader := dial()
+		defer conn.Close()
+
+		proxy.SetBandwidth(100)
+		start := time.Now()
+		Expect(roundTrip(conn, reader, strings.Repeat("a", 19))).To(HaveLen(19))
+		Expect(time.Since(start)).To(BeNumerically(">=", 300*time.Millisecond))
+	})
+
+	It("resets open connections", func() {
+		conn, reader := dial()
+		defer conn.Close()
+		Expect(roundTrip(conn, reader, "hello")).To(Equal("hello"))
+
+		proxy.ResetConnections()
+
+		Eventually(func() error {
+			_, err := roundTrip(conn, reader, "again")
+			return err
+		}).Should(MatchError(ContainSubstring("connection reset")))
+	})
+
+	Context("when black holed", func() {
+		It("drops traffic on existing connections without closing them", func() {
+			conn, reader := dial()
+			defer conn.Close()
+
+			proxy.SetBlackHole(true)
+			_, err := roundTrip(conn, reader, "lost")
+			Expect(err).To(MatchError(ContainSubstring("i/o timeout")))
+
+			proxy.SetBlackHole(false)
+			Expect(roundTrip(conn, reader, "found")).To(Equal("found"))
+		})
+
+		It("holds new connections until the black hole is removed", func() {
+			proxy.SetBlackHole(true)
+			conn, reader := dial()
+			defer conn.Close()
+
+			_, err := roundTrip(conn, reader, "lost")
+			Expect(err).To(MatchError(ContainSubstring("i/o timeout")))
+
+			proxy.SetBlackHole(false)
+			Expect(roundTrip(conn, reader, "found")).To(Equal("found"))
+		})
+	})
+
+	Context("when half open", func() {
+		It("keeps the client connection open but never answers", func() {
+			conn, reader := dial()
+			defer conn.Close()
+			Expect(roundTrip(conn, reader, "hello")).To(Equal("hello"))
+
+			proxy.SetHalfOpen(true)
+
+			_, err := roundTrip(conn, reader, "anyone there")
+			Expect(err).To(MatchError(ContainSubstring("i/o timeout")))
+		})
+	})
+})
@@ -0,0 +1,188 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"code.cloudfoundry.org/cf-networking-helpers/mutualtls"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+	"code.cloudfoundry.org/go-loggregator/rpc/loggregator_v2"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+)
+
+// FakeLoggregatorIngress is a Loggregator v2 ingress server that records
+// every envelope it receives. It can be stopped and started again on the
+// same address to exercise client reconnects.
+type FakeLoggregatorIngress struct {
+	address string
+	creds   credentials.TransportCredentials
+
+	lock      sync.Mutex
+	server    *grpc.Server
+	envelopes []*loggregator_v2.Envelope
+	failing   bool
+}
+
+func NewFakeLoggregatorIngress(certFile, keyFile, caCertFile string) (*FakeLoggregatorIngress, error) {
+	tlsConfig, err := mutualtls.NewServerTLSConfig(certFile, keyFile, caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("server tls config: %s", err)
+	}
+
+	f := &FakeLoggregatorIngress{
+		address: fmt.Sprintf("127.0.0.1:%d", ports.PickAPort()),
+		creds:   credentials.NewTLS(tlsConfig),
+	}
+	return f, f.Start()
+}
+
+func (f *FakeLoggregatorIngress) Address() string {
+	return f.address
+}
+
+func (f *FakeLoggregatorIngress) Start() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.server != nil {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", f.address)
+	if err != nil {
+		return err
+	}
+
+	f.server = grpc.NewServer(grpc.Creds(f.creds))
+	loggregator_v2.RegisterIngressServer(f.server, &ingressServer{fake: f})
+	go f.server.Serve(listener)
+	return nil
+}
+
+// Stop closes the listener and every open connection.
+func (f *FakeLoggregatorIngress) Stop() {
+	f.lock.Lock()
+	server := f.server
+	f.server = nil
+	f.lock.Unlock()
+
+	if server != nil {
+		server.Stop()
+	}
+}
+
+func (f *FakeLoggregatorIngress) Close() error {
+	f.Stop()
+	return nil
+}
+
+// SetFailing makes every send fail with codes.Unavailable while the server
+// keeps accepting connections.
+func (f *FakeLoggregatorIngress) SetFailing(failing bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failing = failing
+}
+
+func (f *FakeLoggregatorIngress) AllEnvelopes() []*loggregator_v2.Envelope {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ret := make([]*loggregator_v2.Envelope, len(f.envelopes))
+	copy(ret, f.envelopes)
+	return ret
+}
+
+// AllEvents flattens the received envelopes into Events the same way
+// FakeMetron reports them. Each value of a gauge becomes its own Event and
+// timers are reported in nanoseconds.
+func (f *FakeLoggregatorIngress) AllEvents() []Event {
+	events := []Event{}
+	for _, envelope := range f.AllEnvelopes() {
+		switch message := envelope.GetMessage().(type) {
+		case *loggregator_v2.Envelope_Gauge:
+			for name, value := range message.Gauge.GetMetrics() {
+				events = append(events, Event{
+					EventType: "Gauge",
+					Name:      name,
+					Origin:    envelope.GetSourceId(),
+					Value:     value.GetValue(),
+				})
+			}
+		case *loggregator_v2.Envelope_Counter:
+			events = append(events, Event{
+				EventType: "Counter",
+				Name:      message.Counter.GetName(),
+				Origin:    envelope.GetSourceId(),
+				Value:     float64(message.Counter.GetDelta()),
+			})
+		case *loggregator_v2.Envelope_Timer:
+			events = append(events, Event{
+				EventType: "Timer",
+				Name:      message.Timer.GetName(),
+				Origin:    envelope.GetSourceId(),
+				Value:     float64(message.Timer.GetStop() - message.Timer.GetStart()),
+			})
+		}
+	}
+	return events
+}
+
+func (f *FakeLoggregatorIngress) receive(envelopes ...*loggregator_v2.Envelope) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.failing {
+		return status.Error(codes.Unavailable, "fake loggregator ingress is failing")
+	}
+	f.envelopes = append(f.envelopes, envelopes...)
+	return nil
+}
+
+type ingressServer struct {
+	fake *FakeLoggregatorIngress
+}
+
+func (s *ingressServer) Sender(stream loggregator_v2.Ingress_SenderServer) error {
+	for {
+		envelope, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&loggregator_v2.IngressResponse{})
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.fake.receive(envelope); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ingressServer) BatchSender(stream loggregator_v2.Ingress_BatchSenderServer) error {
+	for {
+		batch, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&loggregator_v2.BatchSenderResponse{})
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.fake.receive(batch.GetBatch()...); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *ingressServer) Send(ctx context.Context, batch *loggregator_v2.EnvelopeBatch) (*loggregator_v2.SendResponse, error) {
+	if err := s.fake.receive(batch.GetBatch()...); err != nil {
+		return nil, err
+	}
+	return &loggregator_v2.SendResponse{}, nil
+}
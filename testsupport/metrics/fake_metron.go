@@ -18,8 +18,19 @@ type Event struct {
 	Value     float64
 }
 
-type FakeMetron interface {
+// EnvelopeSource is what the matchers in this package inspect.
+type EnvelopeSource interface {
 	AllEvents() []Event
+	AllEnvelopes() []*events.Envelope
+}
+
+type FakeMetron interface {
+	EnvelopeSource
+
+	// FromOrigin only reports the envelopes sent with origin.
+	FromOrigin(origin string) EnvelopeSource
+	// Reset forgets everything received so far.
+	Reset()
 
 	Address() string
 	Close() error
@@ -27,10 +38,10 @@ type FakeMetron interface {
 }
 
 type fakeMetron struct {
-	lock           *sync.Mutex
-	receivedEvents []Event
-	listener       net.PacketConn
-	port           int
+	lock      *sync.Mutex
+	envelopes []*events.Envelope
+	listener  net.PacketConn
+	port      int
 }
 
 func NewFakeMetron(params ...int) *fakeMetron {
@@ -66,19 +77,39 @@ func (f *fakeMetron) Close() error {
 	return f.listener.Close()
 }
 
+// AllEvents summarises the received envelopes. Names and values are taken
+// from the metric name and value where there is one, and otherwise from:
+// HttpStartStop the peer type; LogMessage the source type; Error the
+// source and code; ContainerMetric the application id and CPU percentage.
 func (f *fakeMetron) AllEvents() []Event {
+	return eventsFrom(f.AllEnvelopes())
+}
+
+// AllEnvelopes returns the envelopes as received, with their tags,
+// timestamps, units and counter totals.
+func (f *fakeMetron) AllEnvelopes() []*events.Envelope {
 	f.lock.Lock()
 	defer f.lock.Unlock()
 
-	ret := make([]Event, len(f.receivedEvents))
-	copy(ret, f.receivedEvents)
+	ret := make([]*events.Envelope, len(f.envelopes))
+	copy(ret, f.envelopes)
 	return ret
 }
 
+func (f *fakeMetron) FromOrigin(origin string) EnvelopeSource {
+	return &originFilter{source: f, origin: origin}
+}
+
+func (f *fakeMetron) Reset() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.envelopes = nil
+}
+
 // modified from https://github.com/cloudfoundry/dropsonde/blob/9b2cd8f8f9e99dca1f764ca4511d6011b4f44d0c/integration_test/dropsonde_end_to_end_test.go
 func (f *fakeMetron) listenForEvents() {
+	buffer := make([]byte, 65535)
 	for {
-		buffer := make([]byte, 1024)
 		n, _, err := f.listener.ReadFrom(buffer)
 		if err != nil {
 			return
@@ -93,9 +124,19 @@ func (f *fakeMetron) listenForEvents() {
 			panic(err)
 		}
 
-		var eventId = envelope.GetEventType().String()
+		f.lock.Lock()
+		f.envelopes = append(f.envelopes, envelope)
+		f.lock.Unlock()
+	}
+}
 
-		newEvent := Event{EventType: eventId}
+func eventsFrom(envelopes []*events.Envelope) []Event {
+	ret := make([]Event, 0, len(envelopes))
+	for _, envelope := range envelopes {
+		newEvent := Event{
+			EventType: envelope.GetEventType().String(),
+			Origin:    envelope.GetOrigin(),
+		}
 
 		switch envelope.GetEventType() {
 		case events.Envelope_HttpStartStop:
@@ -108,15 +149,37 @@ func (f *fakeMetron) listenForEvents() {
 			countMetric := envelope.GetCounterEvent()
 			newEvent.Name = countMetric.GetName()
 			newEvent.Value = float64(countMetric.GetDelta())
-		default:
-			panic("Unexpected message type: " + envelope.GetEventType().String())
-
+		case events.Envelope_LogMessage:
+			newEvent.Name = envelope.GetLogMessage().GetSourceType()
+		case events.Envelope_Error:
+			newEvent.Name = envelope.GetError().GetSource()
+			newEvent.Value = float64(envelope.GetError().GetCode())
+		case events.Envelope_ContainerMetric:
+			containerMetric := envelope.GetContainerMetric()
+			newEvent.Name = containerMetric.GetApplicationId()
+			newEvent.Value = containerMetric.GetCpuPercentage()
 		}
 
-		newEvent.Origin = envelope.GetOrigin()
+		ret = append(ret, newEvent)
+	}
+	return ret
+}
 
-		f.lock.Lock()
-		f.receivedEvents = append(f.receivedEvents, newEvent)
-		f.lock.Unlock()
+type originFilter struct {
+	source EnvelopeSource
+	origin string
+}
+
+func (o *originFilter) AllEvents() []Event {
+	return eventsFrom(o.AllEnvelopes())
+}
+
+func (o *originFilter) AllEnvelopes() []*events.Envelope {
+	var ret []*events.Envelope
+	for _, envelope := range o.source.AllEnvelopes() {
+		if envelope.GetOrigin() == o.origin {
+			ret = append(ret, envelope)
+		}
 	}
+	return ret
 }
@@ -0,0 +1,215 @@
+package metrics_test
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/metrics"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/gogo/protobuf/proto"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("FakeMetron", func() {
+	var (
+		fakeMetron metrics.FakeMetron
+		conn       net.Conn
+	)
+
+	send := func(envelope *events.Envelope) {
+		payload, err := proto.Marshal(envelope)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = conn.Write(payload)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	valueMetric := func(origin, name string, value float64) *events.Envelope {
+		return &events.Envelope{
+			Origin:    proto.String(origin),
+			EventType: events.Envelope_ValueMetric.Enum(),
+			Timestamp: proto.Int64(1234),
+			Tags:      map[string]string{"job": "policy-server"},
+			ValueMetric: &events.ValueMetric{
+				Name:  proto.String(name),
+				Value: proto.Float64(value),
+				Unit:  proto.String("ms"),
+			},
+		}
+	}
+
+	counterEvent := func(name string, delta, total uint64) *events.Envelope {
+		return &events.Envelope{
+			Origin:    proto.String("policy-server"),
+			EventType: events.Envelope_CounterEvent.Enum(),
+			CounterEvent: &events.CounterEvent{
+				Name:  proto.String(name),
+				Delta: proto.Uint64(delta),
+				Total: proto.Uint64(total),
+			},
+		}
+	}
+
+	BeforeEach(func() {
+		fakeMetron = metrics.NewFakeMetron()
+
+		var err error
+		conn, err = net.Dial("udp4", fakeMetron.Address())
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		fakeMetron.Close()
+	})
+
+	It("decodes log messages, errors and container metrics", func() {
+		send(&events.Envelope{
+			Origin:     proto.String("policy-server"),
+			EventType:  events.Envelope_LogMessage.Enum(),
+			LogMessage: &events.LogMessage{Message: []byte("hello"), MessageType: events.LogMessage_OUT.Enum(), Timestamp: proto.Int64(1), SourceType: proto.String("APP")},
+		})
+		send(&events.Envelope{
+			Origin:    proto.String("policy-server"),
+			EventType: events.Envelope_Error.Enum(),
+			Error:     &events.Error{Source: proto.String("db"), Code: proto.Int32(500), Message: proto.String("potato")},
+		})
+		send(&events.Envelope{
+			Origin:          proto.String("policy-server"),
+			EventType:       events.Envelope_ContainerMetric.Enum(),
+			ContainerMetric: &events.ContainerMetric{ApplicationId: proto.String("some-app"), InstanceIndex: proto.Int32(0), CpuPercentage: proto.Float64(12.5), MemoryBytes: proto.Uint64(1), DiskBytes: proto.Uint64(2)},
+		})
+
+		Eventually(fakeMetron.AllEvents).Should(ConsistOf(
+			metrics.Event{EventType: "LogMessage", Name: "APP", Origin: "policy-server"},
+			metrics.Event{EventType: "Error", Name: "db", Origin: "policy-server", Value: 500},
+			metrics.Event{EventType: "ContainerMetric", Name: "some-app", Origin: "policy-server", Value: 12.5},
+		))
+		Expect(string(fakeMetron.AllEnvelopes()[0].GetLogMessage().GetMessage())).To(Equal("hello"))
+	})
+
+	It("keeps tags, units, timestamps and totals", func() {
+		send(valueMetric("policy-server", "requestTime", 5))
+		send(counterEvent("requests", 2, 7))
+
+		Eventually(fakeMetron.AllEnvelopes).Should(HaveLen(2))
+		value := fakeMetron.AllEnvelopes()[0]
+		Expect(value.GetTags()).To(Equal(map[string]string{"job": "policy-server"}))
+		Expect(value.GetTimestamp()).To(Equal(int64(1234)))
+		Expect(value.GetValueMetric().GetUnit()).To(Equal("ms"))
+		Expect(fakeMetron.AllEnvelopes()[1].GetCounterEvent().GetTotal()).To(Equal(uint64(7)))
+	})
+
+	It("receives envelopes larger than 1024 bytes", func() {
+		send(valueMetric("policy-server", strings.Repeat("a", 2000), 1))
+		Eventually(fakeMetron).Should(metrics.HaveReceivedValue(strings.Repeat("a", 2000), 1))
+	})
+
+	It("filters by origin", func() {
+		send(valueMetric("policy-server", "uptime", 1))
+		send(valueMetric("asg-syncer", "uptime", 2))
+
+		Eventually(fakeMetron.AllEvents).Should(HaveLen(2))
+		Expect(fakeMetron.FromOrigin("asg-syncer").AllEvents()).To(ConsistOf(
+			metrics.Event{EventType: "ValueMetric", Name: "uptime", Origin: "asg-syncer", Value: 2},
+		))
+		Expect(fakeMetron.FromOrigin("asg-syncer")).NotTo(metrics.HaveReceivedValue("uptime", 1))
+	})
+
+	It("forgets everything on reset", func() {
+		send(valueMetric("policy-server", "uptime", 1))
+		Eventually(fakeMetron.AllEvents).Should(HaveLen(1))
+
+		fakeMetron.Reset()
+		Expect(fakeMetron.AllEvents()).To(BeEmpty())
+		Expect(fakeMetron.AllEnvelopes()).To(BeEmpty())
+	})
+
+	Describe("matchers", func() {
+		BeforeEach(func() {
+			send(valueMetric("policy-server", "uptime", 3))
+			send(counterEvent("requests", 1, 1))
+			send(counterEvent("requests", 4, 5))
+		})
+
+		It("match values by name with numbers or matchers", func() {
+			Eventually(fakeMetron).Should(metrics.HaveReceivedValue("uptime", 3))
+			Expect(fakeMetron).To(metrics.HaveReceivedValue("uptime", BeNumerically(">", 2)))
+			Expect(fakeMetron).NotTo(metrics.HaveReceivedValue("uptime", 4))
+			Expect(fakeMetron).NotTo(metrics.HaveReceivedValue("missing", 3))
+		})
+
+		It("match the sum of the counter deltas", func() {
+			Eventually(fakeMetron).Should(metrics.HaveReceivedCounter("requests", 5))
+			Expect(fakeMetron).NotTo(metrics.HaveReceivedCounter("requests", 4))
+		})
+
+		It("match counters sent by dropsonde, which only sets deltas", func() {
+			sender := metric_sender.NewMetricSender(&udpEventEmitter{conn: conn, origin: "policy-server"})
+			Expect(sender.IncrementCounter("dropsondeRequests")).To(Succeed())
+			Expect(sender.AddToCounter("dropsondeRequests", 2)).To(Succeed())
+			Expect(sender.Counter("dropsondeRequests").SetTag("status", "200").Add(4)).To(Succeed())
+
+			Eventually(fakeMetron).Should(metrics.HaveReceivedCounter("dropsondeRequests", 7))
+		})
+
+		It("match events and envelopes", func() {
+			Eventually(fakeMetron).Should(metrics.HaveReceivedEvent(
+				metrics.Event{EventType: "ValueMetric", Name: "uptime", Origin: "policy-server", Value: 3},
+			))
+			Expect(fakeMetron).To(metrics.HaveReceivedEnvelope(WithTransform(
+				func(e *events.Envelope) map[string]string { return e.GetTags() },
+				HaveKeyWithValue("job", "policy-server"),
+			)))
+		})
+
+		It("explain what was received when they fail", func() {
+			Eventually(fakeMetron).Should(metrics.HaveReceivedCounter("requests", 5))
+			matcher := metrics.HaveReceivedValue("uptime", 4)
+			Expect(matcher.Match(fakeMetron)).To(BeFalse())
+			Expect(matcher.FailureMessage(fakeMetron)).To(ContainSubstring("Received values: [3]"))
+		})
+	})
+})
+
+// udpEventEmitter stands in for dropsonde's UDP emitter, which is not
+// vendored, so that the events come from dropsonde's MetricSender.
+type udpEventEmitter struct {
+	conn   net.Conn
+	origin string
+}
+
+func (e *udpEventEmitter) Origin() string {
+	return e.origin
+}
+
+func (e *udpEventEmitter) Emit(event events.Event) error {
+	envelope := &events.Envelope{
+		Origin:    proto.String(e.origin),
+		Timestamp: proto.Int64(time.Now().UnixNano()),
+	}
+	switch event := event.(type) {
+	case *events.CounterEvent:
+		envelope.EventType = events.Envelope_CounterEvent.Enum()
+		envelope.CounterEvent = event
+	case *events.ValueMetric:
+		envelope.EventType = events.Envelope_ValueMetric.Enum()
+		envelope.ValueMetric = event
+	default:
+		return fmt.Errorf("unsupported event %T", event)
+	}
+	return e.EmitEnvelope(envelope)
+}
+
+func (e *udpEventEmitter) EmitEnvelope(envelope *events.Envelope) error {
+	payload, err := proto.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	_, err = e.conn.Write(payload)
+	return err
+}
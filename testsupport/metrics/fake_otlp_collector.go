@@ -0,0 +1,324 @@
+package metrics
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/mutualtls"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport/ports"
+)
+
+// OTLPMetric is one data point received by a FakeOTLPCollector. Type is
+// "gauge", "sum" or "histogram"; the Value of a histogram is its sum.
+// Interval is the time from the start of a sum to its end.
+type OTLPMetric struct {
+	Type       string
+	Name       string
+	Unit       string
+	Value      float64
+	Interval   time.Duration
+	Attributes map[string]string
+	Resource   map[string]string
+}
+
+type OTLPSpan struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Kind          int
+	StatusCode    int
+	StatusMessage string
+	Attributes    map[string]string
+	Resource      map[string]string
+}
+
+// FakeOTLPCollector is an OTLP/HTTP collector stand-in that accepts JSON
+// encoded metrics and traces over mutual TLS.
+type FakeOTLPCollector struct {
+	address  string
+	server   *http.Server
+	listener net.Listener
+
+	lock    sync.Mutex
+	metrics []OTLPMetric
+	spans   []OTLPSpan
+	failing bool
+}
+
+func NewFakeOTLPCollector(certFile, keyFile, caCertFile string) (*FakeOTLPCollector, error) {
+	tlsConfig, err := mutualtls.NewServerTLSConfig(certFile, keyFile, caCertFile)
+	if err != nil {
+		return nil, fmt.Errorf("server tls config: %s", err)
+	}
+	return newFakeOTLPCollector(tlsConfig)
+}
+
+// NewServerAuthFakeOTLPCollector returns a FakeOTLPCollector that does not
+// ask clients for a certificate.
+func NewServerAuthFakeOTLPCollector(certFile, keyFile string) (*FakeOTLPCollector, error) {
+	keyPair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("server tls config: %s", err)
+	}
+	return newFakeOTLPCollector(&tls.Config{
+		Certificates: []tls.Certificate{keyPair},
+		MinVersion:   tls.VersionTLS12,
+	})
+}
+
+func newFakeOTLPCollector(tlsConfig *tls.Config) (*FakeOTLPCollector, error) {
+	f := &FakeOTLPCollector{
+		address: fmt.Sprintf("127.0.0.1:%d", ports.PickAPort()),
+	}
+	var err error
+	f.listener, err = net.Listen("tcp", f.address)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/metrics", f.receiveMetrics)
+	mux.HandleFunc("/v1/traces", f.receiveTraces)
+	f.server = &http.Server{Handler: mux, TLSConfig: tlsConfig}
+	go f.server.ServeTLS(f.listener, "", "")
+	return f, nil
+}
+
+func (f *FakeOTLPCollector) Endpoint() string {
+	return "https://" + f.address
+}
+
+func (f *FakeOTLPCollector) Close() error {
+	return f.server.Close()
+}
+
+// SetFailing makes every export fail with 503 Service Unavailable.
+func (f *FakeOTLPCollector) SetFailing(failing bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.failing = failing
+}
+
+func (f *FakeOTLPCollector) AllMetrics() []OTLPMetric {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ret := make([]OTLPMetric, len(f.metrics))
+	copy(ret, f.metrics)
+	return ret
+}
+
+// AllEvents reports the received metrics the same way FakeMetron does, with
+// the service.name resource attribute as the origin and histograms as
+// timers in nanoseconds.
+func (f *FakeOTLPCollector) AllEvents() []Event {
+	eventTypes := map[string]string{"gauge": "Gauge", "sum": "Counter", "histogram": "Timer"}
+
+	events := []Event{}
+	for _, metric := range f.AllMetrics() {
+		value := metric.Value
+		if metric.Type == "histogram" {
+			value *= 1e6
+		}
+		events = append(events, Event{
+			EventType: eventTypes[metric.Type],
+			Name:      metric.Name,
+			Origin:    metric.Resource["service.name"],
+			Value:     value,
+		})
+	}
+	return events
+}
+
+func (f *FakeOTLPCollector) AllSpans() []OTLPSpan {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	ret := make([]OTLPSpan, len(f.spans))
+	copy(ret, f.spans)
+	return ret
+}
+
+func (f *FakeOTLPCollector) receiveMetrics(w http.ResponseWriter, req *http.Request) {
+	var request otlpMetricsRequest
+	if !f.decode(w, req, &request) {
+		return
+	}
+
+	var received []OTLPMetric
+	for _, resourceMetrics := range request.ResourceMetrics {
+		resource := attributeMap(resourceMetrics.Resource.Attributes)
+		for _, scopeMetrics := range resourceMetrics.ScopeMetrics {
+			for _, m := range scopeMetrics.Metrics {
+				metric := OTLPMetric{Name: m.Name, Unit: m.Unit, Resource: resource}
+				switch {
+				case m.Gauge != nil:
+					for _, point := range m.Gauge.DataPoints {
+						metric.Type, metric.Value, metric.Attributes = "gauge", point.value(), attributeMap(point.Attributes)
+						received = append(received, metric)
+					}
+				case m.Sum != nil:
+					for _, point := range m.Sum.DataPoints {
+						metric.Type, metric.Value, metric.Attributes = "sum", point.value(), attributeMap(point.Attributes)
+						metric.Interval = point.interval()
+						received = append(received, metric)
+					}
+				case m.Histogram != nil:
+					for _, point := range m.Histogram.DataPoints {
+						metric.Type, metric.Value, metric.Attributes = "histogram", point.Sum, attributeMap(point.Attributes)
+						received = append(received, metric)
+					}
+				}
+			}
+		}
+	}
+
+	f.lock.Lock()
+	f.metrics = append(f.metrics, received...)
+	f.lock.Unlock()
+}
+
+func (f *FakeOTLPCollector) receiveTraces(w http.ResponseWriter, req *http.Request) {
+	var request otlpTracesRequest
+	if !f.decode(w, req, &request) {
+		return
+	}
+
+	var received []OTLPSpan
+	for _, resourceSpans := range request.ResourceSpans {
+		resource := attributeMap(resourceSpans.Resource.Attributes)
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			for _, s := range scopeSpans.Spans {
+				received = append(received, OTLPSpan{
+					TraceID:       s.TraceID,
+					SpanID:        s.SpanID,
+					ParentSpanID:  s.ParentSpanID,
+					Name:          s.Name,
+					Kind:          s.Kind,
+					StatusCode:    s.Status.Code,
+					StatusMessage: s.Status.Message,
+					Attributes:    attributeMap(s.Attributes),
+					Resource:      resource,
+				})
+			}
+		}
+	}
+
+	f.lock.Lock()
+	f.spans = append(f.spans, received...)
+	f.lock.Unlock()
+}
+
+func (f *FakeOTLPCollector) decode(w http.ResponseWriter, req *http.Request, request interface{}) bool {
+	f.lock.Lock()
+	failing := f.failing
+	f.lock.Unlock()
+
+	if failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return false
+	}
+	if req.Method != "POST" || req.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return false
+	}
+	if err := json.NewDecoder(req.Body).Decode(request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return false
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte("{}"))
+	return true
+}
+
+func attributeMap(attributes []otlpKeyValue) map[string]string {
+	m := map[string]string{}
+	for _, attribute := range attributes {
+		m[attribute.Key] = attribute.Value.StringValue
+	}
+	return m
+}
+
+type otlpKeyValue struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue string `json:"stringValue"`
+	} `json:"value"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []struct {
+		Resource     otlpResource `json:"resource"`
+		ScopeMetrics []struct {
+			Metrics []struct {
+				Name  string `json:"name"`
+				Unit  string `json:"unit"`
+				Gauge *struct {
+					DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+				} `json:"gauge"`
+				Sum *struct {
+					DataPoints []otlpNumberDataPoint `json:"dataPoints"`
+				} `json:"sum"`
+				Histogram *struct {
+					DataPoints []struct {
+						Attributes []otlpKeyValue `json:"attributes"`
+						Sum        float64        `json:"sum"`
+					} `json:"dataPoints"`
+				} `json:"histogram"`
+			} `json:"metrics"`
+		} `json:"scopeMetrics"`
+	} `json:"resourceMetrics"`
+}
+
+type otlpNumberDataPoint struct {
+	Attributes        []otlpKeyValue `json:"attributes"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	TimeUnixNano      string         `json:"timeUnixNano"`
+	AsDouble          *float64       `json:"asDouble"`
+	AsInt             string         `json:"asInt"`
+}
+
+func (p otlpNumberDataPoint) value() float64 {
+	if p.AsDouble != nil {
+		return *p.AsDouble
+	}
+	value, _ := strconv.ParseInt(p.AsInt, 10, 64)
+	return float64(value)
+}
+
+func (p otlpNumberDataPoint) interval() time.Duration {
+	start, _ := strconv.ParseInt(p.StartTimeUnixNano, 10, 64)
+	end, _ := strconv.ParseInt(p.TimeUnixNano, 10, 64)
+	return time.Duration(end - start)
+}
+
+type otlpTracesRequest struct {
+	ResourceSpans []struct {
+		Resource   otlpResource `json:"resource"`
+		ScopeSpans []struct {
+			Spans []struct {
+				TraceID      string         `json:"traceId"`
+				SpanID       string         `json:"spanId"`
+				ParentSpanID string         `json:"parentSpanId"`
+				Name         string         `json:"name"`
+				Kind         int            `json:"kind"`
+				Attributes   []otlpKeyValue `json:"attributes"`
+				Status       struct {
+					Code    int    `json:"code"`
+					Message string `json:"message"`
+				} `json:"status"`
+			} `json:"spans"`
+		} `json:"scopeSpans"`
+	} `json:"resourceSpans"`
+}
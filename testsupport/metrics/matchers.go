@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"fmt"
+
+	"github.com/cloudfoundry/sonde-go/events"
+	"github.com/onsi/gomega"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// HaveReceivedValue succeeds if an EnvelopeSource such as FakeMetron has
+// received a ValueMetric called name whose value matches value, which is a
+// number or a matcher:
+//
+//	Eventually(fakeMetron).Should(HaveReceivedValue("uptime", BeNumerically(">", 0)))
+func HaveReceivedValue(name string, value interface{}) types.GomegaMatcher {
+	return &receivedMatcher{
+		description: fmt.Sprintf("a value metric %q", name),
+		matcher:     numberMatcher(value),
+		find: func(envelope *events.Envelope) (interface{}, bool) {
+			metric := envelope.GetValueMetric()
+			return metric.GetValue(), metric != nil && metric.GetName() == name
+		},
+	}
+}
+
+// HaveReceivedCounter succeeds if the deltas of the CounterEvents called
+// name add up to a total that matches total, which is a number or a matcher.
+// Senders such as dropsonde only set the delta; totals are kept by metron.
+func HaveReceivedCounter(name string, total interface{}) types.GomegaMatcher {
+	return &receivedMatcher{
+		description: fmt.Sprintf("a counter %q", name),
+		matcher:     numberMatcher(total),
+		sum:         true,
+		find: func(envelope *events.Envelope) (interface{}, bool) {
+			counter := envelope.GetCounterEvent()
+			return counter.GetDelta(), counter != nil && counter.GetName() == name
+		},
+	}
+}
+
+// HaveReceivedEvent succeeds if one of the received Events matches event,
+// which is an Event or a matcher.
+func HaveReceivedEvent(event interface{}) types.GomegaMatcher {
+	return gomega.WithTransform(func(source EnvelopeSource) []Event {
+		return source.AllEvents()
+	}, gomega.ContainElement(event))
+}
+
+// HaveReceivedEnvelope succeeds if one of the received envelopes matches
+// matcher, e.g. to check tags, units or timestamps.
+func HaveReceivedEnvelope(matcher types.GomegaMatcher) types.GomegaMatcher {
+	return gomega.WithTransform(func(source EnvelopeSource) []*events.Envelope {
+		return source.AllEnvelopes()
+	}, gomega.ContainElement(matcher))
+}
+
+func numberMatcher(expected interface{}) types.GomegaMatcher {
+	if matcher, ok := expected.(types.GomegaMatcher); ok {
+		return matcher
+	}
+	return gomega.BeNumerically("==", expected)
+}
+
+type receivedMatcher struct {
+	description string
+	matcher     types.GomegaMatcher
+	sum         bool
+	find        func(*events.Envelope) (interface{}, bool)
+
+	seen []interface{}
+}
+
+func (m *receivedMatcher) Match(actual interface{}) (bool, error) {
+	source, ok := actual.(EnvelopeSource)
+	if !ok {
+		return false, fmt.Errorf("expected an EnvelopeSource such as FakeMetron, got %s", format.Object(actual, 1))
+	}
+
+	m.seen = nil
+	for _, envelope := range source.AllEnvelopes() {
+		if value, found := m.find(envelope); found {
+			m.seen = append(m.seen, value)
+		}
+	}
+
+	candidates := m.seen
+	if m.sum && len(candidates) > 0 {
+		var total uint64
+		for _, delta := range candidates {
+			total += delta.(uint64)
+		}
+		candidates = []interface{}{total}
+	}
+	for _, value := range candidates {
+		if matched, err := m.matcher.Match(value); err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func (m *receivedMatcher) FailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected to have received %s matching\n%s\nReceived values: %v",
+		m.description, format.Object(m.matcher, 1), m.seen)
+}
+
+func (m *receivedMatcher) NegatedFailureMessage(actual interface{}) string {
+	return fmt.Sprintf("Expected not to have received %s matching\n%s\nReceived values: %v",
+		m.description, format.Object(m.matcher, 1), m.seen)
+}
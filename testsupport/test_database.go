@@ -0,0 +1,436 @@
+package testsupport
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"code.cloudfoundry.org/cf-networking-helpers/db"
+	"github.com/onsi/ginkgo/config"
+	"gopkg.in/yaml.v3"
+)
+
+// TestDatabaseManager hands out uniquely named databases for tests and
+// drops every database it created on Cleanup or on interrupt.
+type TestDatabaseManager struct {
+	baseConfig db.Config
+	prefix     string
+	counter    uint64
+
+	lock      sync.Mutex
+	databases map[string]*TestDatabase
+
+	interruptOnce sync.Once
+}
+
+type TestDatabase struct {
+	Config  db.Config
+	Conn    *db.ConnWrapper
+	manager *TestDatabaseManager
+}
+
+type Fixture struct {
+	Table string
+	Rows  []map[string]interface{}
+}
+
+func NewTestDatabaseManager(baseConfig db.Config, prefix string) *TestDatabaseManager {
+	return &TestDatabaseManager{
+		baseConfig: baseConfig,
+		prefix:     prefix,
+		databases:  map[string]*TestDatabase{},
+	}
+}
+
+func (m *TestDatabaseManager) uniqueName() string {
+	count := atomic.AddUint64(&m.counter, 1)
+	return fmt.Sprintf("%s_%d_%d_%d_%x",
+		m.prefix, config.GinkgoConfig.ParallelNode, os.Getpid(), count, rand.Uint32())
+}
+
+// Create creates a new, empty database and returns a connection to it.
+func (m *TestDatabaseManager) Create() (*TestDatabase, error) {
+	name := m.uniqueName()
+
+	adminConn, err := getDbConnection(m.adminConfig())
+	if err != nil {
+		return nil, err
+	}
+	defer adminConn.Close()
+
+	if _, err = adminConn.Exec(fmt.Sprintf("CREATE DATABASE %s", quoteIdentifier(m.baseConfig.Type, name))); err != nil {
+		return nil, fmt.Errorf("create database %s: %s", name, err)
+	}
+
+	dbConfig := m.baseConfig
+	dbConfig.DatabaseName = name
+
+	testDatabase := &TestDatabase{
+		Config:  dbConfig,
+		manager: m,
+	}
+
+	m.lock.Lock()
+	m.databases[name] = testDatabase
+	m.lock.Unlock()
+
+	testDatabase.Conn, err = getDbConnection(dbConfig)
+	if err != nil {
+		m.drop(name)
+		return nil, err
+	}
+
+	return testDatabase, nil
+}
+
+// Cleanup drops every database created by the manager that has not already
+// been dropped. It is safe to call more than once.
+func (m *TestDatabaseManager) Cleanup() error {
+	m.lock.Lock()
+	names := make([]string, 0, len(m.databases))
+	for name := range m.databases {
+		names = append(names, name)
+	}
+	m.lock.Unlock()
+
+	var errs []string
+	for _, name := range names {
+		if err := m.drop(name); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("cleanup test databases: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// CleanupOnInterrupt drops all databases when the process receives SIGINT or
+// SIGTERM, then re-raises the signal.
+func (m *TestDatabaseManager) CleanupOnInterrupt() {
+	m.interruptOnce.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			m.Cleanup()
+			signal.Stop(signals)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				p.Signal(sig)
+			}
+		}()
+	})
+}
+
+func (m *TestDatabaseManager) adminConfig() db.Config {
+	adminConfig := m.baseConfig
+	adminConfig.DatabaseName = ""
+	adminConfig.Timeout = 120
+	return adminConfig
+}
+
+func (m *TestDatabaseManager) drop(name string) error {
+	m.lock.Lock()
+	testDatabase, ok := m.databases[name]
+	delete(m.databases, name)
+	m.lock.Unlock()
+
+	if !ok {
+		return nil
+	}
+	if testDatabase.Conn != nil {
+		testDatabase.Conn.Close()
+	}
+
+	adminConn, err := getDbConnection(m.adminConfig())
+	if err != nil {
+		return err
+	}
+	defer adminConn.Close()
+
+	if _, err = adminConn.Exec(fmt.Sprintf("DROP DATABASE IF EXISTS %s", quoteIdentifier(m.baseConfig.Type, name))); err != nil {
+		return fmt.Errorf("drop database %s: %s", name, err)
+	}
+	return nil
+}
+
+// Drop closes the connection and drops the database.
+func (t *TestDatabase) Drop() error {
+	return t.manager.drop(t.Config.DatabaseName)
+}
+
+// ApplySchema executes each statement in order.
+func (t *TestDatabase) ApplySchema(statements ...string) error {
+	for _, statement := range statements {
+		if strings.TrimSpace(statement) == "" {
+			continue
+		}
+		if _, err := t.Conn.Exec(statement); err != nil {
+			return fmt.Errorf("apply schema: %s", err)
+		}
+	}
+	return nil
+}
+
+// ApplyMigrations executes every *.sql file in dir in lexical order, split
+// into statements by SplitStatements.
+func (t *TestDatabase) ApplyMigrations(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return fmt.Errorf("list migrations: %s", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("read migration: %s", err)
+		}
+		if err = t.ApplySchema(SplitStatements(t.Config.Type, string(contents))...); err != nil {
+			return fmt.Errorf("%s: %s", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+// LoadFixtures inserts the rows from a YAML or JSON fixture file.
+func (t *TestDatabase) LoadFixtures(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read fixtures: %s", err)
+	}
+
+	fixtures, err := ParseFixtures(contents)
+	if err != nil {
+		return err
+	}
+
+	return t.InsertFixtures(fixtures...)
+}
+
+func (t *TestDatabase) InsertFixtures(fixtures ...Fixture) error {
+	for _, fixture := range fixtures {
+		for _, row := range fixture.Rows {
+			columns := make([]string, 0, len(row))
+			for column := range row {
+				columns = append(columns, column)
+			}
+			sort.Strings(columns)
+
+			quoted := make([]string, len(columns))
+			placeholders := make([]string, len(columns))
+			values := make([]interface{}, len(columns))
+			for i, column := range columns {
+				quoted[i] = t.quote(column)
+				placeholders[i] = "?"
+				values[i] = row[column]
+			}
+
+			query := t.Conn.Rebind(fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+				t.quote(fixture.Table), strings.Join(quoted, ", "), strings.Join(placeholders, ", ")))
+			if _, err := t.Conn.Exec(query, values...); err != nil {
+				return fmt.Errorf("insert fixture into %s: %s", fixture.Table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Truncate empties the given tables, or every table in the database when
+// none are given.
+func (t *TestDatabase) Truncate(tables ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if len(tables) == 0 {
+		var err error
+		tables, err = t.tableNames(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	if len(tables) == 0 {
+		return nil
+	}
+
+	conn, err := t.Conn.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("truncate: %s", err)
+	}
+	defer conn.Close()
+
+	quoted := make([]string, len(tables))
+	for i, table := range tables {
+		quoted[i] = t.quote(table)
+	}
+
+	switch t.Config.Type {
+	case "postgres":
+		_, err = conn.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s RESTART IDENTITY CASCADE", strings.Join(quoted, ", ")))
+	case "mysql":
+		if _, err = conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			break
+		}
+		for _, table := range quoted {
+			if _, err = conn.ExecContext(ctx, fmt.Sprintf("TRUNCATE TABLE %s", table)); err != nil {
+				break
+			}
+		}
+		conn.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	default:
+		err = fmt.Errorf("database type '%s' is not supported", t.Config.Type)
+	}
+	if err != nil {
+		return fmt.Errorf("truncate: %s", err)
+	}
+	return nil
+}
+
+func (t *TestDatabase) quote(identifier string) string {
+	return quoteIdentifier(t.Config.Type, identifier)
+}
+
+// quoteIdentifier quotes an identifier with backticks for MySQL, where
+// double quotes make a string literal, and with double quotes otherwise.
+func quoteIdentifier(dbType, identifier string) string {
+	if dbType == "mysql" {
+		return "`" + strings.Replace(identifier, "`", "``", -1) + "`"
+	}
+	return `"` + strings.Replace(identifier, `"`, `""`, -1) + `"`
+}
+
+func (t *TestDatabase) tableNames(ctx context.Context) ([]string, error) {
+	var query string
+	switch t.Config.Type {
+	case "postgres":
+		query = "SELECT tablename FROM pg_tables WHERE schemaname = current_schema()"
+	case "mysql":
+		query = "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE()"
+	default:
+		return nil, fmt.Errorf("database type '%s' is not supported", t.Config.Type)
+	}
+
+	var tables []string
+	if err := t.Conn.SelectContext(ctx, &tables, query); err != nil {
+		return nil, fmt.Errorf("list tables: %s", err)
+	}
+	return tables, nil
+}
+
+// SplitStatements splits SQL for the given database type on the semicolons
+// that end statements. It skips semicolons in quoted strings and
+// identifiers and in comments, and for postgres in dollar-quoted bodies such
+// as $$ ... $$ or $body$ ... $body$. Statements that are only comments are
+// dropped.
+func SplitStatements(dbType, sql string) []string {
+	mysql := dbType == "mysql"
+
+	var statements []string
+	start, hasCode := 0, false
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case strings.HasPrefix(sql[i:], "--") || mysql && c == '#':
+			i = skipUntil(sql, i, "\n")
+			continue
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipUntil(sql, i+2, "*/")
+			continue
+		case c == ';':
+			if hasCode {
+				statements = append(statements, sql[start:i])
+			}
+			start, hasCode = i+1, false
+			continue
+		case c == '\'' || c == '"' || mysql && c == '`':
+			i = skipQuoted(sql, i, c, mysql && c != '`')
+		case !mysql && c == '$':
+			if tag := dollarQuoteTag(sql[i:]); tag != "" {
+				i = skipUntil(sql, i+len(tag), tag)
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		}
+		hasCode = true
+	}
+	if hasCode {
+		statements = append(statements, sql[start:])
+	}
+	return statements
+}
+
+// skipQuoted returns the index of the quote that closes the one at start. A
+// doubled quote escapes it, and so does a backslash with backslashEscapes.
+func skipQuoted(sql string, start int, quote byte, backslashEscapes bool) int {
+	for i := start + 1; i < len(sql); i++ {
+		switch {
+		case backslashEscapes && sql[i] == '\\':
+			i++
+		case sql[i] == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		case sql[i] == quote:
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// skipUntil returns the index of the last byte of the first end at or after
+// start.
+func skipUntil(sql string, start int, end string) int {
+	if i := strings.Index(sql[start:], end); i >= 0 {
+		return start + i + len(end) - 1
+	}
+	return len(sql)
+}
+
+// dollarQuoteTag returns the $tag$ that sql starts with, or "".
+func dollarQuoteTag(sql string) string {
+	for i := 1; i < len(sql); i++ {
+		c := sql[i]
+		if c == '$' {
+			return sql[:i+1]
+		}
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 1 && c >= '0' && c <= '9') {
+			return ""
+		}
+	}
+	return ""
+}
+
+// ParseFixtures parses a YAML or JSON document mapping table names to lists
+// of rows. Tables are returned in document order so that rows referenced by
+// foreign keys can be listed first.
+func ParseFixtures(contents []byte) ([]Fixture, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(contents, &document); err != nil {
+		return nil, fmt.Errorf("parse fixtures: %s", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("parse fixtures: expected a mapping of table names to rows")
+	}
+
+	fixtures := []Fixture{}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		fixture := Fixture{Table: root.Content[i].Value}
+		if err := root.Content[i+1].Decode(&fixture.Rows); err != nil {
+			return nil, fmt.Errorf("parse fixtures for %s: %s", fixture.Table, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
@@ -0,0 +1,113 @@
+package testsupport_test
+
+import (
+	"strings"
+
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseFixtures", func() {
+	It("parses YAML fixtures in document order", func() {
+		fixtures, err := testsupport.ParseFixtures([]byte(`
+users:
+  - id: 1
+    name: alice
+  - id: 2
+    name: bob
+groups:
+  - id: 10
+    owner_id: 1
+`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fixtures).To(Equal([]testsupport.Fixture{
+			{
+				Table: "users",
+				Rows: []map[string]interface{}{
+					{"id": 1, "name": "alice"},
+					{"id": 2, "name": "bob"},
+				},
+			},
+			{
+				Table: "groups",
+				Rows: []map[string]interface{}{
+					{"id": 10, "owner_id": 1},
+				},
+			},
+		}))
+	})
+
+	It("parses JSON fixtures", func() {
+		fixtures, err := testsupport.ParseFixtures([]byte(`{"zebras": [{"name": "z"}], "apples": [{"name": "a"}]}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fixtures).To(HaveLen(2))
+		Expect(fixtures[0].Table).To(Equal("zebras"))
+		Expect(fixtures[1].Table).To(Equal("apples"))
+		Expect(fixtures[1].Rows).To(Equal([]map[string]interface{}{{"name": "a"}}))
+	})
+
+	It("returns nothing for an empty document", func() {
+		fixtures, err := testsupport.ParseFixtures([]byte(""))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fixtures).To(BeEmpty())
+	})
+
+	Context("when the document is not a mapping", func() {
+		It("returns an error", func() {
+			_, err := testsupport.ParseFixtures([]byte(`- a`))
+			Expect(err).To(MatchError(ContainSubstring("expected a mapping of table names to rows")))
+		})
+	})
+
+	Context("when a table's rows are malformed", func() {
+		It("returns an error naming the table", func() {
+			_, err := testsupport.ParseFixtures([]byte(`users: 5`))
+			Expect(err).To(MatchError(ContainSubstring("parse fixtures for users")))
+		})
+	})
+})
+
+var _ = Describe("SplitStatements", func() {
+	trimmed := func(statements []string) []string {
+		for i := range statements {
+			statements[i] = strings.TrimSpace(statements[i])
+		}
+		return statements
+	}
+
+	It("splits on semicolons and drops empty statements", func() {
+		Expect(trimmed(testsupport.SplitStatements("postgres", "SELECT 1;\n;\nSELECT 2"))).To(Equal([]string{"SELECT 1", "SELECT 2"}))
+	})
+
+	It("keeps semicolons in strings, identifiers and comments", func() {
+		sql := `INSERT INTO "a;b" VALUES ('x;y', 'it''s;');
+-- a comment; with a semicolon
+/* another; one */ SELECT 2;
+-- trailing comment;`
+		Expect(trimmed(testsupport.SplitStatements("postgres", sql))).To(Equal([]string{
+			`INSERT INTO "a;b" VALUES ('x;y', 'it''s;')`,
+			"-- a comment; with a semicolon\n/* another; one */ SELECT 2",
+		}))
+	})
+
+	It("keeps semicolons in postgres dollar-quoted bodies", func() {
+		sql := `CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;
+CREATE FUNCTION g() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql;
+SELECT $1`
+		Expect(trimmed(testsupport.SplitStatements("postgres", sql))).To(Equal([]string{
+			"CREATE FUNCTION f() RETURNS int AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql",
+			"CREATE FUNCTION g() RETURNS int AS $$ SELECT 1; $$ LANGUAGE sql",
+			"SELECT $1",
+		}))
+	})
+
+	It("follows mysql quoting and comments", func() {
+		sql := "INSERT INTO `a;b` VALUES ('it\\'s;');\n# a comment;\nSELECT 2"
+		Expect(trimmed(testsupport.SplitStatements("mysql", sql))).To(Equal([]string{
+			"INSERT INTO `a;b` VALUES ('it\\'s;')",
+			"# a comment;\nSELECT 2",
+		}))
+	})
+})
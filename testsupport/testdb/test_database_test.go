@@ -0,0 +1,186 @@
+package testdb_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"code.cloudfoundry.org/cf-networking-helpers/db"
+	"code.cloudfoundry.org/cf-networking-helpers/testsupport"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TestDatabaseManager", func() {
+	var (
+		dbConf  db.Config
+		manager *testsupport.TestDatabaseManager
+	)
+
+	// quote quotes identifiers in the test schemas the way the database
+	// under test expects.
+	quote := func(identifier string) string {
+		if dbConf.Type == "mysql" {
+			return "`" + identifier + "`"
+		}
+		return `"` + identifier + `"`
+	}
+
+	count := func(testDatabase *testsupport.TestDatabase, table string) int {
+		var n int
+		Expect(testDatabase.Conn.QueryRow("SELECT COUNT(*) FROM " + quote(table)).Scan(&n)).To(Succeed())
+		return n
+	}
+
+	BeforeEach(func() {
+		dbConf = testsupport.GetDBConfig()
+		manager = testsupport.NewTestDatabaseManager(dbConf, "testsupport")
+	})
+
+	AfterEach(func() {
+		Expect(manager.Cleanup()).To(Succeed())
+	})
+
+	Describe("Create", func() {
+		It("creates a separate database for each call", func() {
+			first, err := manager.Create()
+			Expect(err).NotTo(HaveOccurred())
+			second, err := manager.Create()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(first.Config.DatabaseName).NotTo(Equal(second.Config.DatabaseName))
+
+			var databaseName string
+			query := "SELECT DATABASE()"
+			if dbConf.Type == "postgres" {
+				query = "SELECT current_database()"
+			}
+			Expect(first.Conn.QueryRow(query).Scan(&databaseName)).To(Succeed())
+			Expect(databaseName).To(Equal(first.Config.DatabaseName))
+		})
+	})
+
+	Describe("Cleanup", func() {
+		It("drops every database it created and can be called again", func() {
+			testDatabase, err := manager.Create()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(manager.Cleanup()).To(Succeed())
+			Expect(manager.Cleanup()).To(Succeed())
+
+			_, err = db.GetConnectionPool(testDatabase.Config, context.Background())
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("with a schema", func() {
+		var testDatabase *testsupport.TestDatabase
+
+		BeforeEach(func() {
+			var err error
+			testDatabase, err = manager.Create()
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(testDatabase.ApplySchema(
+				"CREATE TABLE "+quote("groups")+" (id INT PRIMARY KEY, "+quote("order")+" INT)",
+				"  ",
+				"CREATE TABLE "+quote("users")+" (id INT PRIMARY KEY, name VARCHAR(255))",
+			)).To(Succeed())
+		})
+
+		Describe("ApplySchema", func() {
+			It("returns the first failing statement's error", func() {
+				err := testDatabase.ApplySchema("CREATE TABLE " + quote("users") + " (id INT)")
+				Expect(err).To(MatchError(ContainSubstring("apply schema")))
+			})
+		})
+
+		Describe("ApplyMigrations", func() {
+			var dir string
+
+			BeforeEach(func() {
+				var err error
+				dir, err = ioutil.TempDir("", "migrations")
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(ioutil.WriteFile(filepath.Join(dir, "002_insert.sql"), []byte(
+					"INSERT INTO "+quote("widgets")+" (id, note) VALUES (1, 'a;b');\n"+
+						"-- a comment; with a semicolon\n"+
+						"INSERT INTO "+quote("widgets")+" (id, note) VALUES (2, 'it''s; fine');\n",
+				), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "001_create.sql"), []byte(
+					"CREATE TABLE "+quote("widgets")+" (id INT PRIMARY KEY, note VARCHAR(255));",
+				), 0644)).To(Succeed())
+				Expect(ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("not sql"), 0644)).To(Succeed())
+			})
+
+			AfterEach(func() {
+				os.RemoveAll(dir)
+			})
+
+			It("applies the .sql files in lexical order", func() {
+				Expect(testDatabase.ApplyMigrations(dir)).To(Succeed())
+				Expect(count(testDatabase, "widgets")).To(Equal(2))
+
+				var note string
+				Expect(testDatabase.Conn.QueryRow("SELECT note FROM " + quote("widgets") + " WHERE id = 2").Scan(&note)).To(Succeed())
+				Expect(note).To(Equal("it's; fine"))
+			})
+
+			It("names the file that failed", func() {
+				Expect(ioutil.WriteFile(filepath.Join(dir, "003_bad.sql"), []byte("NOT SQL"), 0644)).To(Succeed())
+				Expect(testDatabase.ApplyMigrations(dir)).To(MatchError(ContainSubstring("003_bad.sql")))
+			})
+		})
+
+		Describe("InsertFixtures", func() {
+			It("inserts rows into tables and columns named after reserved words", func() {
+				Expect(testDatabase.InsertFixtures(
+					testsupport.Fixture{Table: "groups", Rows: []map[string]interface{}{
+						{"id": 1, "order": 10},
+						{"id": 2, "order": 20},
+					}},
+					testsupport.Fixture{Table: "users", Rows: []map[string]interface{}{
+						{"id": 1, "name": "alice"},
+					}},
+				)).To(Succeed())
+
+				var order int
+				Expect(testDatabase.Conn.QueryRow(
+					testDatabase.Conn.Rebind("SELECT "+quote("order")+" FROM "+quote("groups")+" WHERE id = ?"), 2,
+				).Scan(&order)).To(Succeed())
+				Expect(order).To(Equal(20))
+				Expect(count(testDatabase, "users")).To(Equal(1))
+			})
+
+			It("names the table when an insert fails", func() {
+				err := testDatabase.InsertFixtures(testsupport.Fixture{Table: "users", Rows: []map[string]interface{}{
+					{"id": 1, "missing": "column"},
+				}})
+				Expect(err).To(MatchError(ContainSubstring("insert fixture into users")))
+			})
+		})
+
+		Describe("Truncate", func() {
+			BeforeEach(func() {
+				Expect(testDatabase.InsertFixtures(
+					testsupport.Fixture{Table: "groups", Rows: []map[string]interface{}{{"id": 1, "order": 1}}},
+					testsupport.Fixture{Table: "users", Rows: []map[string]interface{}{{"id": 1, "name": "alice"}}},
+				)).To(Succeed())
+			})
+
+			It("empties the given tables", func() {
+				Expect(testDatabase.Truncate("groups")).To(Succeed())
+				Expect(count(testDatabase, "groups")).To(Equal(0))
+				Expect(count(testDatabase, "users")).To(Equal(1))
+			})
+
+			It("empties every table when none are given", func() {
+				Expect(testDatabase.Truncate()).To(Succeed())
+				Expect(count(testDatabase, "groups")).To(Equal(0))
+				Expect(count(testDatabase, "users")).To(Equal(0))
+			})
+		})
+	})
+})
@@ -0,0 +1,13 @@
+package testdb_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestTestdb(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Testdb Suite")
+}
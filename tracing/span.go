@@ -0,0 +1,133 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string {
+	return hex.EncodeToString(t[:])
+}
+
+func (s SpanID) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (t TraceID) IsValid() bool {
+	return t != TraceID{}
+}
+
+func (s SpanID) IsValid() bool {
+	return s != SpanID{}
+}
+
+func NewTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+	return id
+}
+
+func NewSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+	return id
+}
+
+// SpanKind values match the OpenTelemetry span kinds.
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is a finished unit of work such as an HTTP request or a database
+// query. A span without a parent starts a new trace.
+type Span struct {
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Name         string
+	Kind         SpanKind
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+	Err          error
+}
+
+// StartSpan begins a span that continues parent's trace, or a new trace if
+// parent is nil. The caller sets End and records it.
+func StartSpan(name string, kind SpanKind, parent *Span) Span {
+	span := Span{
+		SpanID: NewSpanID(),
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+	}
+	if parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.TraceID = NewTraceID()
+	}
+	return span
+}
+
+//go:generate counterfeiter -o ../fakes/span_recorder.go --fake-name SpanRecorder . SpanRecorder
+type SpanRecorder interface {
+	RecordSpan(Span)
+}
+
+type spanContextKey struct{}
+
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, span)
+}
+
+func SpanFromContext(ctx context.Context) (Span, bool) {
+	span, ok := ctx.Value(spanContextKey{}).(Span)
+	return span, ok
+}
+
+// ParseTraceparent reads the trace and parent span from a W3C traceparent
+// header, e.g. "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func ParseTraceparent(header string) (Span, error) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return Span{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+
+	var span Span
+	if len(parts[1]) != 32 {
+		return Span{}, fmt.Errorf("invalid trace id %q", parts[1])
+	}
+	if _, err := hex.Decode(span.TraceID[:], []byte(parts[1])); err != nil {
+		return Span{}, fmt.Errorf("invalid trace id %q", parts[1])
+	}
+	if len(parts[2]) != 16 {
+		return Span{}, fmt.Errorf("invalid parent id %q", parts[2])
+	}
+	if _, err := hex.Decode(span.SpanID[:], []byte(parts[2])); err != nil {
+		return Span{}, fmt.Errorf("invalid parent id %q", parts[2])
+	}
+	if !span.TraceID.IsValid() || !span.SpanID.IsValid() {
+		return Span{}, fmt.Errorf("invalid traceparent %q", header)
+	}
+	return span, nil
+}
+
+// Traceparent formats the W3C traceparent header that makes span the parent
+// of the receiver's spans.
+func (s Span) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-01", s.TraceID, s.SpanID)
+}
@@ -0,0 +1,63 @@
+package tracing_test
+
+import (
+	"context"
+
+	"code.cloudfoundry.org/cf-networking-helpers/tracing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Span", func() {
+	Describe("StartSpan", func() {
+		It("starts a new trace without a parent", func() {
+			span := tracing.StartSpan("work", tracing.SpanKindInternal, nil)
+			Expect(span.TraceID.IsValid()).To(BeTrue())
+			Expect(span.SpanID.IsValid()).To(BeTrue())
+			Expect(span.ParentSpanID.IsValid()).To(BeFalse())
+		})
+
+		It("continues the trace of the parent", func() {
+			parent := tracing.StartSpan("request", tracing.SpanKindServer, nil)
+			span := tracing.StartSpan("query", tracing.SpanKindClient, &parent)
+			Expect(span.TraceID).To(Equal(parent.TraceID))
+			Expect(span.ParentSpanID).To(Equal(parent.SpanID))
+			Expect(span.SpanID).NotTo(Equal(parent.SpanID))
+		})
+	})
+
+	Describe("traceparent", func() {
+		It("round trips", func() {
+			span := tracing.StartSpan("request", tracing.SpanKindServer, nil)
+			parsed, err := tracing.ParseTraceparent(span.Traceparent())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed.TraceID).To(Equal(span.TraceID))
+			Expect(parsed.SpanID).To(Equal(span.SpanID))
+		})
+
+		DescribeTable("rejects invalid headers",
+			func(header string) {
+				_, err := tracing.ParseTraceparent(header)
+				Expect(err).To(HaveOccurred())
+			},
+			Entry("empty", ""),
+			Entry("short trace id", "00-4bf92f35-00f067aa0ba902b7-01"),
+			Entry("long parent id", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7aa-01"),
+			Entry("zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01"),
+			Entry("not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01"),
+			Entry("invalid version", "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"),
+		)
+	})
+
+	It("is carried by a context", func() {
+		span := tracing.StartSpan("request", tracing.SpanKindServer, nil)
+		found, ok := tracing.SpanFromContext(tracing.ContextWithSpan(context.Background(), span))
+		Expect(ok).To(BeTrue())
+		Expect(found.SpanID).To(Equal(span.SpanID))
+
+		_, ok = tracing.SpanFromContext(context.Background())
+		Expect(ok).To(BeFalse())
+	})
+})